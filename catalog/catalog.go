@@ -0,0 +1,204 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"animenya.site/db"
+	"animenya.site/imagecache"
+	"animenya.site/lib"
+	"animenya.site/model"
+	"animenya.site/resolver"
+	"github.com/rs/zerolog/log"
+)
+
+// Catalog is the write path of the stored anime, it merges data coming from
+// the source into the existing records.
+type Catalog struct {
+	DB      db.DBInterface
+	Fetcher lib.FetcherInterface
+	Images  *imagecache.Cache
+
+	queue    *refreshQueue
+	previews *previewQueue
+	// animeLocks serializes the read-merge-save of each anime, see UpdateAnime
+	animeLocks keyedMutex[int]
+	// reportLocks serializes the read-modify-write of each watch report
+	reportLocks keyedMutex[string]
+}
+
+func New(db db.DBInterface, fetch lib.FetcherInterface, images *imagecache.Cache) *Catalog {
+	return &Catalog{
+		DB:      db,
+		Fetcher: fetch,
+		Images:  images,
+	}
+}
+
+// RefreshAnime fetches the stale sections of the anime from the source and
+// saves the merged result.
+func (c *Catalog) RefreshAnime(ctx context.Context, anime *model.Anime) (*model.Anime, error) {
+	now := time.Now()
+	metadataStale := anime.IsMetadataStale() || anime.PostID == nil
+	episodesStale := anime.IsEpisodesStale()
+	if !metadataStale && !episodesStale {
+		return anime, nil
+	}
+
+	incoming := &model.Anime{}
+	postID := anime.PostID
+	if metadataStale {
+		detail, err := c.Fetcher.GetAnimeDetailByAnimeSlug(ctx, &anime.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if detail == nil {
+			return nil, fmt.Errorf("NOT_FOUND")
+		}
+
+		incoming = detail
+		if detail.PostID != nil {
+			postID = detail.PostID
+		}
+	}
+
+	detail, err := c.Fetcher.GetAnimeDetailByPostID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if detail == nil {
+		return nil, fmt.Errorf("NOT_FOUND")
+	}
+
+	detail.EpisodesFetchedAt = &now
+	if metadataStale {
+		detail.MetadataFetchedAt = &now
+	}
+	c.resolveNewWatches(ctx, anime, detail)
+	incoming = model.Merge(incoming, detail)
+
+	return c.UpdateAnime(anime.ID, func(*model.Anime) (*model.Anime, error) {
+		return incoming, nil
+	})
+}
+
+// resolveNewWatches resolves the watches of the detail which the anime has not
+// resolved yet, the resolved ones keep their sources, see model.Merge.
+func (c *Catalog) resolveNewWatches(ctx context.Context, anime *model.Anime, detail *model.Anime) {
+	known := map[string]bool{}
+	for _, episode := range anime.Episodes {
+		for _, watch := range episode.Watches {
+			known[watch.StreamURL] = len(watch.Sources) > 0
+		}
+	}
+
+	var watches []*model.Watch
+	for _, episode := range detail.Episodes {
+		for _, watch := range episode.Watches {
+			if !known[watch.StreamURL] {
+				watches = append(watches, watch)
+			}
+		}
+	}
+
+	resolver.ResolveWatches(ctx, watches)
+}
+
+// RefreshWatches fetches the watches and the downloads of the episode from the
+// source, resolves the direct sources of the watches and saves them into the
+// anime.
+func (c *Catalog) RefreshWatches(ctx context.Context, anime *model.Anime, episodeID int) (*model.Anime, error) {
+	var episode *model.Episode
+	for _, _episode := range anime.Episodes {
+		if _episode.ID == episodeID {
+			episode = _episode
+			break
+		}
+	}
+	if episode == nil {
+		return nil, fmt.Errorf("EPISODE_NOT_FOUND")
+	}
+
+	fetched, err := c.Fetcher.GetEpisodeByEpisodeIDAndEpisodeSlug(ctx, &episodeID, &episode.Slug)
+	if err != nil {
+		now := time.Now()
+		if _, _err := c.UpdateAnime(anime.ID, func(*model.Anime) (*model.Anime, error) {
+			return &model.Anime{Episodes: []*model.Episode{{ID: episodeID, WatchesFailedAt: &now}}}, nil
+		}); _err != nil {
+			log.Error().Err(_err).Msg("catalog.RefreshWatches: failed to save failed fetch")
+		}
+
+		return nil, err
+	}
+	resolver.ResolveWatches(ctx, fetched.Watches)
+
+	return c.UpdateAnime(anime.ID, func(*model.Anime) (*model.Anime, error) {
+		return &model.Anime{Episodes: []*model.Episode{fetched}}, nil
+	})
+}
+
+// MarkWatchBroken flags the watch as reported broken, so its episode watches
+// are scraped again on the next read, see model.Watch.IsStale.
+func (c *Catalog) MarkWatchBroken(animeID int, episodeID int, watchID int) error {
+	_, err := c.UpdateAnime(animeID, func(existing *model.Anime) (*model.Anime, error) {
+		for _, episode := range existing.Episodes {
+			if episode.ID != episodeID {
+				continue
+			}
+
+			for _, watch := range episode.Watches {
+				if watch.ID != watchID {
+					continue
+				}
+
+				now := time.Now()
+				return &model.Anime{
+					Episodes: []*model.Episode{{
+						ID:      episodeID,
+						Watches: []*model.Watch{{ID: watch.ID, StreamURL: watch.StreamURL, BrokenAt: &now}},
+					}},
+				}, nil
+			}
+		}
+
+		return nil, fmt.Errorf("WATCH_NOT_FOUND")
+	})
+
+	return err
+}
+
+// SaveSearchResults fills the stored anime with the search hits, see
+// model.Merge, and saves them in a single batch.
+func (c *Catalog) SaveSearchResults(hits []*model.Anime) ([]*model.Anime, error) {
+	var ids []int
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	unlock := c.lockAnime(ids)
+	defer unlock()
+
+	var result []*model.Anime
+	for _, hit := range hits {
+		anime := model.Anime{ID: hit.ID}
+		if err := anime.Get(c.DB); err != nil {
+			if err.Error() != "NOT_FOUND" {
+				return nil, err
+			}
+		}
+
+		// a hit only fills the fields the stored anime is missing, the detail
+		// page has the authoritative title, cover and metadata
+		result = append(result, model.Merge(hit, &anime))
+	}
+
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	if err := model.SaveAnimeBatch(c.DB, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
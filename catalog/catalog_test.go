@@ -0,0 +1,65 @@
+package catalog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"animenya.site/db"
+	"animenya.site/model"
+)
+
+func TestSaveSearchResults(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	c := New(db.New(), nil, nil)
+	fetchedAt := time.Now()
+	synopsis := "From the detail page"
+	stored := &model.Anime{
+		ID:                1,
+		Title:             "Sousou no Frieren",
+		CoverURL:          "https://source/detail-cover.jpg",
+		Synopsis:          &synopsis,
+		MetadataFetchedAt: &fetchedAt,
+	}
+	if err := stored.Save(c.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := c.SaveSearchResults([]*model.Anime{
+		{ID: 1, Title: "Frieren", Slug: "frieren", CoverURL: "https://source/search-cover.jpg"},
+		{ID: 2, Title: "Solo Leveling", Slug: "solo-leveling", CoverURL: "https://source/solo.jpg"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("saved %d anime, want 2", len(saved))
+	}
+
+	anime := model.Anime{ID: 1}
+	if err := anime.Get(c.DB); err != nil {
+		t.Fatal(err)
+	}
+	if anime.Title != stored.Title || anime.CoverURL != stored.CoverURL || anime.Synopsis == nil || *anime.Synopsis != synopsis {
+		t.Errorf("search hit replaced the detail fields: %q %q", anime.Title, anime.CoverURL)
+	}
+	if anime.Slug != "frieren" {
+		t.Errorf("slug %q, want the missing field filled by the hit", anime.Slug)
+	}
+
+	anime = model.Anime{ID: 2}
+	if err := anime.Get(c.DB); err != nil {
+		t.Fatal(err)
+	}
+	if anime.Title != "Solo Leveling" || anime.CoverURL != "https://source/solo.jpg" {
+		t.Errorf("new hit saved as %q %q", anime.Title, anime.CoverURL)
+	}
+}
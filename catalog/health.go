@@ -0,0 +1,163 @@
+package catalog
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"animenya.site/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// healthCheckEvery is how often a watch is checked again
+	healthCheckEvery = time.Hour * 6
+	// healthHostInterval is the minimum time between two checks on one host
+	healthHostInterval = time.Second * 2
+	healthTimeout      = time.Second * 10
+)
+
+// StartHealthCheck checks the stream URL of every stored watch in the
+// background, scanning the catalog again every interval.
+func (c *Catalog) StartHealthCheck(interval time.Duration) {
+	go func() {
+		checker := healthChecker{
+			catalog:   c,
+			client:    &http.Client{Timeout: healthTimeout},
+			lastCheck: map[string]time.Time{},
+		}
+
+		for {
+			checker.run()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+type healthChecker struct {
+	catalog   *Catalog
+	client    *http.Client
+	lastCheck map[string]time.Time
+}
+
+func (hc *healthChecker) run() {
+	anime, err := model.ListAnime(hc.catalog.DB)
+	if err != nil {
+		log.Error().Err(err).Msg("catalog.healthChecker: failed to list anime")
+		return
+	}
+
+	for _, a := range anime {
+		results := map[string]*model.Watch{}
+		for _, episode := range a.Episodes {
+			for _, watch := range episode.Watches {
+				if watch.Health != nil && watch.Health.CheckedAt != nil && time.Since(*watch.Health.CheckedAt) < healthCheckEvery {
+					continue
+				}
+
+				results[watch.StreamURL] = hc.check(watch)
+			}
+		}
+
+		if len(results) == 0 {
+			continue
+		}
+
+		if err := hc.save(a.ID, results); err != nil {
+			log.Error().Err(err).Int("anime_id", a.ID).Msg("catalog.healthChecker: failed to save watches health")
+		}
+	}
+}
+
+// check returns a copy of the watch with the result of a new check.
+func (hc *healthChecker) check(watch *model.Watch) *model.Watch {
+	if wait := healthHostInterval - time.Since(hc.lastCheck[watch.Host]); wait > 0 {
+		time.Sleep(wait)
+	}
+	hc.lastCheck[watch.Host] = time.Now()
+
+	checked := *watch
+	health := model.WatchHealth{}
+	if watch.Health != nil {
+		health = *watch.Health
+	}
+
+	start := time.Now()
+	statusCode, err := hc.request(http.MethodHead, watch.StreamURL)
+	// a lot of embed hosts do not allow HEAD requests
+	if err != nil || statusCode >= http.StatusBadRequest {
+		statusCode, err = hc.request(http.MethodGet, watch.StreamURL)
+	}
+
+	now := time.Now()
+	health.CheckedAt = &now
+	health.StatusCode = statusCode
+	health.LatencyMS = now.Sub(start).Milliseconds()
+	if err != nil || statusCode >= http.StatusBadRequest {
+		health.ConsecutiveFailures++
+	} else {
+		health.ConsecutiveFailures = 0
+		checked.LastVerifiedAt = &now
+	}
+
+	checked.Health = &health
+	return &checked
+}
+
+func (hc *healthChecker) request(method string, url string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("referer", os.Getenv("SOURCE_URL"))
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// save merges the checked watches into the current stored anime, it is read
+// again since it may have changed while the checks were running.
+func (hc *healthChecker) save(animeID int, results map[string]*model.Watch) error {
+	var failing int
+	_, err := hc.catalog.UpdateAnime(animeID, func(existing *model.Anime) (*model.Anime, error) {
+		checked := model.Anime{ID: animeID}
+		for _, episode := range existing.Episodes {
+			var watches []*model.Watch
+			for _, watch := range episode.Watches {
+				result, ok := results[watch.StreamURL]
+				if !ok {
+					continue
+				}
+
+				watches = append(watches, result)
+				if !result.IsHealthy() {
+					failing++
+				}
+			}
+
+			if len(watches) > 0 {
+				checked.Episodes = append(checked.Episodes, &model.Episode{ID: episode.ID, Watches: watches})
+			}
+		}
+
+		return &checked, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failing > 0 {
+		log.Warn().Int("anime_id", animeID).Int("failing", failing).Msg("catalog.healthChecker: watches failing health checks")
+	}
+
+	return nil
+}
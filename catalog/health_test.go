@@ -0,0 +1,90 @@
+package catalog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"animenya.site/db"
+	"animenya.site/model"
+)
+
+func TestHealthCheck(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := New(db.New(), nil, nil)
+	old := time.Now().Add(-healthCheckEvery * 2)
+	recent := time.Now().Add(-time.Minute)
+	anime := model.Anime{ID: 1, Episodes: []*model.Episode{{ID: 10, Watches: []*model.Watch{
+		// the hosts differ so the checks do not wait for healthHostInterval
+		{ID: 1, Host: "ok", StreamURL: server.URL + "/ok", Health: &model.WatchHealth{CheckedAt: &old, ConsecutiveFailures: 2}},
+		{ID: 2, Host: "no-head", StreamURL: server.URL + "/no-head"},
+		{ID: 3, Host: "dead", StreamURL: server.URL + "/dead", Health: &model.WatchHealth{CheckedAt: &old, ConsecutiveFailures: model.MaxWatchFailures - 1}},
+		{ID: 4, Host: "recent", StreamURL: server.URL + "/dead?recent", Health: &model.WatchHealth{CheckedAt: &recent}},
+	}}}}
+	if err := anime.Save(c.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := healthChecker{catalog: c, client: server.Client(), lastCheck: map[string]time.Time{}}
+	checker.run()
+
+	if err := anime.Get(c.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		statusCode int
+		failures   int
+		verified   bool
+		healthy    bool
+	}{
+		{"a passing check resets the failures", http.StatusOK, 0, true, true},
+		{"a refused HEAD is checked with GET", http.StatusOK, 0, true, true},
+		{"a failing check hides the watch after MaxWatchFailures", http.StatusNotFound, model.MaxWatchFailures, false, false},
+		{"a recently checked watch is skipped", 0, 0, false, true},
+	}
+
+	watches := anime.Episodes[0].Watches
+	if len(watches) != len(tests) {
+		t.Fatalf("%d watches, want %d", len(watches), len(tests))
+	}
+	for i, test := range tests {
+		watch := watches[i]
+		if watch.Health.StatusCode != test.statusCode {
+			t.Errorf("%s: status code %d, want %d", test.name, watch.Health.StatusCode, test.statusCode)
+		}
+		if watch.Health.ConsecutiveFailures != test.failures {
+			t.Errorf("%s: %d failures, want %d", test.name, watch.Health.ConsecutiveFailures, test.failures)
+		}
+		if verified := watch.LastVerifiedAt != nil; verified != test.verified {
+			t.Errorf("%s: verified %v, want %v", test.name, verified, test.verified)
+		}
+		if watch.IsHealthy() != test.healthy {
+			t.Errorf("%s: healthy %v, want %v", test.name, watch.IsHealthy(), test.healthy)
+		}
+	}
+}
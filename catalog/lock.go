@@ -0,0 +1,97 @@
+package catalog
+
+import (
+	"sort"
+	"sync"
+
+	"animenya.site/model"
+)
+
+// keyedMutex serializes the work on one key, e.g. an anime id, without
+// blocking the other keys. The lock of a key is dropped once nobody holds or
+// waits for it.
+type keyedMutex[K comparable] struct {
+	mu    sync.Mutex
+	locks map[K]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock locks the key and returns the function unlocking it.
+func (k *keyedMutex[K]) lock(key K) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[K]*keyedLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// UpdateAnime reads the stored anime, merges the data returned by update into
+// it and saves it, while no other write to the same anime runs. The anime
+// given to update is the stored one, or an empty one with the id when it is
+// not stored yet. update returning nil saves nothing.
+func (c *Catalog) UpdateAnime(animeID int, update func(existing *model.Anime) (*model.Anime, error)) (*model.Anime, error) {
+	unlock := c.animeLocks.lock(animeID)
+	defer unlock()
+
+	anime := &model.Anime{ID: animeID}
+	if err := anime.Get(c.DB); err != nil && err.Error() != "NOT_FOUND" {
+		return nil, err
+	}
+
+	incoming, err := update(anime)
+	if err != nil {
+		return nil, err
+	}
+	if incoming == nil {
+		return anime, nil
+	}
+
+	if err := anime.Update(c.DB, incoming); err != nil {
+		return nil, err
+	}
+
+	return anime, nil
+}
+
+// lockAnime locks every anime of the ids in ascending order, so two batches
+// sharing anime cannot deadlock, and returns the function unlocking them.
+func (c *Catalog) lockAnime(ids []int) func() {
+	sorted := append([]int(nil), ids...)
+	sort.Ints(sorted)
+
+	var unlocks []func()
+	for i, id := range sorted {
+		if i > 0 && sorted[i-1] == id {
+			continue
+		}
+		unlocks = append(unlocks, c.animeLocks.lock(id))
+	}
+
+	return func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+}
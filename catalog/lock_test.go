@@ -0,0 +1,51 @@
+package catalog
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"animenya.site/db"
+	"animenya.site/model"
+)
+
+func TestUpdateAnimeKeepsConcurrentWrites(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	c := New(db.New(), nil, nil)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := c.UpdateAnime(1, func(*model.Anime) (*model.Anime, error) {
+				return &model.Anime{AlternativeTitles: []string{strconv.Itoa(i)}}, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	anime := model.Anime{ID: 1}
+	if err := anime.Get(c.DB); err != nil {
+		t.Fatal(err)
+	}
+	if len(anime.AlternativeTitles) != writers {
+		t.Errorf("got %d titles, want %d", len(anime.AlternativeTitles), writers)
+	}
+	if len(c.animeLocks.locks) != 0 {
+		t.Errorf("%d locks left behind", len(c.animeLocks.locks))
+	}
+}
@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"animenya.site/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	previewQueueSize = 256
+	previewTimeout   = time.Second * 30
+	// previewRetryAfter keeps a failing cover from being fetched on every save
+	previewRetryAfter = time.Hour
+)
+
+// previewQueue computes the cover previews in the background, a cover is
+// queued at most once until it is done.
+type previewQueue struct {
+	jobs     chan int
+	mu       sync.Mutex
+	pending  map[int]bool
+	failedAt map[string]time.Time
+}
+
+// StartPreviews runs the background cover preview workers, EnqueuePreview is
+// a no-op until it is called.
+func (c *Catalog) StartPreviews(workers int) {
+	c.previews = &previewQueue{
+		jobs:     make(chan int, previewQueueSize),
+		pending:  map[int]bool{},
+		failedAt: map[string]time.Time{},
+	}
+
+	for i := 0; i < workers; i++ {
+		go c.previewWorker()
+	}
+}
+
+// EnqueuePreview queues the computation of the cover blurhash and color when
+// the anime has none for its current cover, it is meant as a model.OnSave
+// hook.
+func (c *Catalog) EnqueuePreview(a *model.Anime) {
+	if c.previews == nil || c.Images == nil || !c.previews.claim(a) {
+		return
+	}
+
+	select {
+	case c.previews.jobs <- a.ID:
+	default:
+		// the next save queues it again
+		c.previews.release(a.ID)
+	}
+}
+
+// BackfillPreviews queues every stored anime missing the preview of its
+// cover, waiting for room in the queue where EnqueuePreview gives up. It is
+// run once at startup for the anime saved before the previews existed.
+func (c *Catalog) BackfillPreviews() {
+	if c.previews == nil || c.Images == nil {
+		return
+	}
+
+	animes, err := model.ListAnime(c.DB)
+	if err != nil {
+		log.Error().Err(err).Msg("catalog.BackfillPreviews: failed to list anime")
+		return
+	}
+
+	queued := 0
+	for _, anime := range animes {
+		if !c.previews.claim(anime) {
+			continue
+		}
+
+		c.previews.jobs <- anime.ID
+		queued++
+	}
+
+	log.Info().Int("queued", queued).Msg("catalog.BackfillPreviews: cover previews queued")
+}
+
+// claim marks the anime as pending when its cover needs a preview and it is
+// neither queued nor recently failed.
+func (q *previewQueue) claim(a *model.Anime) bool {
+	if a.CoverURL == "" || a.CoverPreviewOf == a.CoverURL {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending[a.ID] || time.Since(q.failedAt[a.CoverURL]) < previewRetryAfter {
+		return false
+	}
+
+	q.pending[a.ID] = true
+	return true
+}
+
+func (q *previewQueue) release(animeID int) {
+	q.mu.Lock()
+	delete(q.pending, animeID)
+	q.mu.Unlock()
+}
+
+func (c *Catalog) previewWorker() {
+	for animeID := range c.previews.jobs {
+		c.preview(animeID)
+		c.previews.release(animeID)
+	}
+}
+
+func (c *Catalog) preview(animeID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+
+	anime := model.Anime{ID: animeID}
+	if err := anime.Get(c.DB); err != nil {
+		log.Error().Err(err).Int("anime_id", animeID).Msg("catalog.preview: failed to get anime from db")
+		return
+	}
+
+	if anime.CoverURL == "" || anime.CoverPreviewOf == anime.CoverURL {
+		return
+	}
+
+	preview, err := c.Images.Preview(ctx, anime.CoverURL)
+	if err != nil {
+		c.previews.mu.Lock()
+		c.previews.failedAt[anime.CoverURL] = time.Now()
+		c.previews.mu.Unlock()
+
+		log.Error().Err(err).Int("anime_id", animeID).Msg("catalog.preview: failed to compute cover preview")
+		return
+	}
+
+	_, err = c.UpdateAnime(animeID, func(existing *model.Anime) (*model.Anime, error) {
+		// the cover may have changed while the preview was computed
+		if existing.CoverURL != anime.CoverURL {
+			return nil, nil
+		}
+
+		return &model.Anime{
+			CoverBlurhash:  preview.Blurhash,
+			CoverColor:     preview.Color,
+			CoverPreviewOf: anime.CoverURL,
+		}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Int("anime_id", animeID).Msg("catalog.preview: failed to save cover preview")
+	}
+}
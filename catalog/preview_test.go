@@ -0,0 +1,75 @@
+package catalog
+
+import (
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"animenya.site/db"
+	"animenya.site/imagecache"
+	"animenya.site/model"
+)
+
+func TestBackfillPreviews(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	db := db.New()
+	c := New(db, nil, imagecache.New(db))
+	// a queue smaller than the backlog, the backfill has to wait for room
+	c.previews = &previewQueue{
+		jobs:     make(chan int, 1),
+		pending:  map[int]bool{},
+		failedAt: map[string]time.Time{"https://failed": time.Now()},
+	}
+
+	animes := []*model.Anime{
+		{ID: 1, CoverURL: "https://1"},
+		{ID: 2, CoverURL: "https://2", CoverPreviewOf: "https://2"},
+		{ID: 3},
+		{ID: 4, CoverURL: "https://4", CoverPreviewOf: "https://old"},
+		{ID: 5, CoverURL: "https://failed"},
+		{ID: 6, CoverURL: "https://6"},
+	}
+	for _, anime := range animes {
+		if err := anime.Save(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.previews.pending[6] = true
+
+	done := make(chan struct{})
+	go func() {
+		c.BackfillPreviews()
+		close(done)
+	}()
+
+	var queued []int
+	for len(queued) < 2 {
+		select {
+		case animeID := <-c.previews.jobs:
+			queued = append(queued, animeID)
+		case <-time.After(time.Second):
+			t.Fatalf("queued %v, want [1 4]", queued)
+		}
+	}
+	<-done
+
+	sort.Ints(queued)
+	if len(queued) != 2 || queued[0] != 1 || queued[1] != 4 {
+		t.Errorf("queued %v, want [1 4]", queued)
+	}
+	if len(c.previews.jobs) != 0 {
+		t.Errorf("%d unexpected jobs left", len(c.previews.jobs))
+	}
+	if !c.previews.pending[1] || !c.previews.pending[4] {
+		t.Error("queued anime are not pending")
+	}
+}
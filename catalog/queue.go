@@ -0,0 +1,152 @@
+package catalog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"animenya.site/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	refreshQueueSize = 256
+	refreshTimeout   = time.Minute
+)
+
+// refreshQueue runs RefreshAnime and RefreshWatches in the background, a job
+// is queued at most once until it is done.
+type refreshQueue struct {
+	jobs    chan refreshJob
+	mu      sync.Mutex
+	pending map[refreshJob]bool
+	// stopped drops the queued jobs and refuses new ones, see Stop
+	stopped bool
+	workers sync.WaitGroup
+}
+
+// refreshJob refreshes the anime, or only the watches of the episode when
+// EpisodeID is set.
+type refreshJob struct {
+	AnimeID   int
+	EpisodeID int
+}
+
+// Start runs the background refresh workers, EnqueueRefresh is a no-op until
+// it is called.
+func (c *Catalog) Start(workers int) {
+	c.queue = &refreshQueue{
+		jobs:    make(chan refreshJob, refreshQueueSize),
+		pending: map[refreshJob]bool{},
+	}
+
+	c.queue.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go c.refreshWorker()
+	}
+}
+
+// Stop refuses new refreshes, drops the queued ones, the next read queues them
+// again, and waits for the running ones until the context is done.
+func (c *Catalog) Stop(ctx context.Context) error {
+	if c.queue == nil {
+		return nil
+	}
+
+	c.queue.mu.Lock()
+	if !c.queue.stopped {
+		c.queue.stopped = true
+		close(c.queue.jobs)
+	}
+	c.queue.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.queue.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// EnqueueRefresh queues a background refresh of the anime and reports whether
+// it was queued. A full queue drops the refresh, the next read retries it.
+func (c *Catalog) EnqueueRefresh(animeID int) bool {
+	return c.enqueue(refreshJob{AnimeID: animeID})
+}
+
+// EnqueueWatchesRefresh queues a background refresh of the episode watches,
+// see EnqueueRefresh.
+func (c *Catalog) EnqueueWatchesRefresh(animeID int, episodeID int) bool {
+	return c.enqueue(refreshJob{AnimeID: animeID, EpisodeID: episodeID})
+}
+
+func (c *Catalog) enqueue(job refreshJob) bool {
+	if c.queue == nil {
+		return false
+	}
+
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+
+	if c.queue.stopped {
+		return false
+	}
+	if c.queue.pending[job] {
+		return true
+	}
+
+	select {
+	case c.queue.jobs <- job:
+		c.queue.pending[job] = true
+		return true
+	default:
+		log.Warn().Int("anime_id", job.AnimeID).Int("episode_id", job.EpisodeID).Msg("catalog.enqueue: queue is full")
+		return false
+	}
+}
+
+func (c *Catalog) refreshWorker() {
+	defer c.queue.workers.Done()
+
+	for job := range c.queue.jobs {
+		c.queue.mu.Lock()
+		stopped := c.queue.stopped
+		c.queue.mu.Unlock()
+
+		if !stopped {
+			c.refresh(job)
+		}
+
+		c.queue.mu.Lock()
+		delete(c.queue.pending, job)
+		c.queue.mu.Unlock()
+	}
+}
+
+func (c *Catalog) refresh(job refreshJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	anime := model.Anime{ID: job.AnimeID}
+	if err := anime.Get(c.DB); err != nil {
+		log.Error().Err(err).Int("anime_id", job.AnimeID).Msg("catalog.refresh: failed to get anime from db")
+		return
+	}
+
+	if job.EpisodeID != 0 {
+		if _, err := c.RefreshWatches(ctx, &anime, job.EpisodeID); err != nil {
+			log.Error().Err(err).Int("anime_id", job.AnimeID).Int("episode_id", job.EpisodeID).Msg("catalog.refresh: failed to refresh episode watches")
+		}
+		return
+	}
+
+	if _, err := c.RefreshAnime(ctx, &anime); err != nil {
+		log.Error().Err(err).Int("anime_id", job.AnimeID).Msg("catalog.refresh: failed to refresh anime")
+	}
+}
@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"animenya.site/db"
+	"animenya.site/lib"
+	"animenya.site/model"
+)
+
+// blockingFetcher holds every detail fetch until release is closed, the
+// methods the tests do not expect panic on the nil interface.
+type blockingFetcher struct {
+	lib.FetcherInterface
+	started chan int
+	release chan struct{}
+	calls   int32
+}
+
+func (f *blockingFetcher) GetAnimeDetailByAnimeSlug(ctx context.Context, animeSlug *string) (*model.Anime, error) {
+	atomic.AddInt32(&f.calls, 1)
+	f.started <- 1
+	<-f.release
+	return nil, nil
+}
+
+func TestEnqueue(t *testing.T) {
+	c := New(nil, nil, nil)
+	if c.EnqueueRefresh(1) {
+		t.Error("queued before Start")
+	}
+
+	c.Start(0)
+	tests := []struct {
+		name  string
+		job   func() bool
+		want  bool
+		queue int
+	}{
+		{"anime", func() bool { return c.EnqueueRefresh(1) }, true, 1},
+		{"same anime", func() bool { return c.EnqueueRefresh(1) }, true, 1},
+		{"episode of the same anime", func() bool { return c.EnqueueWatchesRefresh(1, 10) }, true, 2},
+		{"same episode", func() bool { return c.EnqueueWatchesRefresh(1, 10) }, true, 2},
+		{"other anime", func() bool { return c.EnqueueRefresh(2) }, true, 3},
+	}
+
+	for _, test := range tests {
+		if got := test.job(); got != test.want {
+			t.Errorf("%s: queued %v, want %v", test.name, got, test.want)
+		}
+		if len(c.queue.jobs) != test.queue {
+			t.Errorf("%s: %d jobs, want %d", test.name, len(c.queue.jobs), test.queue)
+		}
+	}
+
+	for id := 3; len(c.queue.jobs) < refreshQueueSize; id++ {
+		c.EnqueueRefresh(id)
+	}
+	if c.EnqueueRefresh(0) {
+		t.Error("queued in a full queue")
+	}
+}
+
+func TestStop(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	fetch := &blockingFetcher{started: make(chan int, 2), release: make(chan struct{})}
+	c := New(db.New(), fetch, nil)
+	for _, id := range []int{1, 2} {
+		anime := model.Anime{ID: id, Slug: "anime"}
+		if err := anime.Save(c.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Start(1)
+	c.EnqueueRefresh(1)
+	<-fetch.started
+	// queued behind the running refresh, it is dropped by Stop
+	c.EnqueueRefresh(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := c.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("stop with a running refresh: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if c.EnqueueRefresh(3) {
+		t.Error("queued after Stop")
+	}
+
+	close(fetch.release)
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&fetch.calls); calls != 1 {
+		t.Errorf("%d refreshes ran, want 1", calls)
+	}
+}
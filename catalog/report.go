@@ -0,0 +1,107 @@
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"animenya.site/model"
+	"github.com/rs/zerolog/log"
+)
+
+// ReportWatch records a client report of a dead watch. Once enough distinct
+// clients reported it, see model.WatchReportThreshold, the watch is marked
+// broken and a refresh of the episode watches is queued.
+func (c *Catalog) ReportWatch(anime *model.Anime, episodeID int, watchID int, client string, reason string) (*model.WatchReport, error) {
+	var watch *model.Watch
+	for _, episode := range anime.Episodes {
+		if episode.ID != episodeID {
+			continue
+		}
+
+		for _, _watch := range episode.Watches {
+			if _watch.ID == watchID {
+				watch = _watch
+				break
+			}
+		}
+	}
+	if watch == nil {
+		return nil, fmt.Errorf("WATCH_NOT_FOUND")
+	}
+
+	report := model.WatchReport{ID: model.WatchReportID(anime.ID, episodeID, watchID)}
+	unlock := c.reportLocks.lock(report.ID)
+	defer unlock()
+
+	if err := report.Get(c.DB); err != nil {
+		if err.Error() != "NOT_FOUND" {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	report.AnimeID = anime.ID
+	report.EpisodeID = episodeID
+	report.WatchID = watchID
+	report.Source = watch.Source
+	report.StreamURL = watch.StreamURL
+	report.Status = model.WatchReportStatusOpen
+	report.Reports = append(report.Reports, &model.Report{
+		Client:    hashClient(client),
+		Reason:    reason,
+		CreatedAt: &now,
+	})
+
+	rescrape := report.PendingClients() >= model.WatchReportThreshold
+	if rescrape {
+		report.Status = model.WatchReportStatusRescraped
+		report.RescrapedAt = &now
+	}
+
+	// the report is kept even when the watch cannot be marked below
+	if err := report.Save(c.DB); err != nil {
+		return nil, err
+	}
+
+	if rescrape {
+		if err := c.MarkWatchBroken(anime.ID, episodeID, watchID); err != nil {
+			log.Error().Err(err).Str("report_id", report.ID).Msg("catalog.ReportWatch: failed to mark watch as broken")
+		}
+
+		// a full queue is fine, the broken watch is scraped again on the next read
+		c.EnqueueWatchesRefresh(anime.ID, episodeID)
+	}
+
+	return &report, nil
+}
+
+// DismissReport closes the report without scraping the watch again, the
+// clients have to report it again to reach the threshold.
+func (c *Catalog) DismissReport(reportID string) (*model.WatchReport, error) {
+	report := model.WatchReport{ID: reportID}
+	unlock := c.reportLocks.lock(report.ID)
+	defer unlock()
+
+	if err := report.Get(c.DB); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report.Status = model.WatchReportStatusDismissed
+	report.DismissedAt = &now
+	if err := report.Save(c.DB); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// hashClient keeps reports from the same client apart without storing its
+// address.
+func hashClient(client string) string {
+	sum := sha256.Sum256([]byte(os.Getenv("REPORT_SALT") + client))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package catalog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"animenya.site/db"
+	"animenya.site/model"
+)
+
+func TestReportWatch(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	c := New(db.New(), nil, nil)
+	c.queue = &refreshQueue{jobs: make(chan refreshJob, 1), pending: map[refreshJob]bool{}}
+
+	fetchedAt := time.Now().Add(-time.Hour)
+	anime, err := c.UpdateAnime(1, func(*model.Anime) (*model.Anime, error) {
+		return &model.Anime{Episodes: []*model.Episode{{
+			ID:               2,
+			WatchesFetchedAt: &fetchedAt,
+			Watches:          []*model.Watch{{ID: 3, StreamURL: "https://a", FetchedAt: &fetchedAt}},
+		}}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ReportWatch(anime, 2, 4, "10.0.0.1", ""); err == nil || err.Error() != "WATCH_NOT_FOUND" {
+		t.Fatalf("unknown watch: got %v", err)
+	}
+
+	for i, client := range []string{"10.0.0.1", "10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		report, err := c.ReportWatch(anime, 2, 3, client, "dead")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := model.WatchReportStatusOpen
+		if i == 3 {
+			want = model.WatchReportStatusRescraped
+		}
+		if report.Status != want {
+			t.Errorf("report %d: status = %q, want %q", i, report.Status, want)
+		}
+	}
+
+	select {
+	case job := <-c.queue.jobs:
+		if job != (refreshJob{AnimeID: 1, EpisodeID: 2}) {
+			t.Errorf("queued %+v", job)
+		}
+	default:
+		t.Error("no watches refresh queued")
+	}
+
+	stored := model.Anime{ID: 1}
+	if err := stored.Get(c.DB); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Episodes[0].Watches[0].BrokenAt == nil {
+		t.Error("watch not marked broken")
+	}
+
+	report, err := c.DismissReport(model.WatchReportID(1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != model.WatchReportStatusDismissed || report.PendingClients() != 0 {
+		t.Errorf("dismissed report: status %q, %d pending", report.Status, report.PendingClients())
+	}
+
+	report, err = c.ReportWatch(anime, 2, 3, "10.0.0.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != model.WatchReportStatusOpen || report.PendingClients() != 1 {
+		t.Errorf("reopened report: status %q, %d pending", report.Status, report.PendingClients())
+	}
+}
@@ -0,0 +1,19 @@
+package data
+
+// AnimeAliases maps well known english names and nicknames to the romanized
+// title used by the source, both written in lowercase.
+var AnimeAliases = map[string]string{
+	"my hero academia":       "boku no hero academia",
+	"attack on titan":        "shingeki no kyojin",
+	"demon slayer":           "kimetsu no yaiba",
+	"the apothecary diaries": "kusuriya no hitorigoto",
+	"frieren":                "sousou no frieren",
+	"spy family":             "spy x family",
+	"mushoku tensei":         "mushoku tensei isekai ittara honki dasu",
+	"slime":                  "tensei shitara slime datta ken",
+	"konosuba":               "kono subarashii sekai ni shukufuku wo",
+	"rezero":                 "re zero kara hajimeru isekai seikatsu",
+	"aot":                    "shingeki no kyojin",
+	"mha":                    "boku no hero academia",
+	"bnha":                   "boku no hero academia",
+}
@@ -1,6 +1,9 @@
 package data
 
 const (
-	DBAnime   = "anime/"
-	DBAccount = "account/"
+	DBAnime    = "anime/"
+	DBAccount  = "account/"
+	DBReport   = "report/"
+	DBSubtitle = "subtitle/"
+	DBImage    = "image/"
 )
@@ -3,18 +3,30 @@ package db
 import (
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 )
 
+// recordMode is the mode of the record files, as created by os.Create under
+// the usual umask.
+const recordMode = 0644
+
 type DBInterface interface {
 	Get(path string, id *string) (*[]byte, error)
 	Save(path string, id *string, content *[]byte) error
+	SaveBatch(path string, contents map[string][]byte) error
+	List(path string) ([]string, error)
+	Delete(path string, id *string) error
 }
 
 func New() *DB {
 	return &DB{}
 }
 
-type DB struct{}
+type DB struct {
+	// mu serializes the renames of Save and SaveBatch
+	mu sync.Mutex
+}
 
 func (db *DB) Get(path string, id *string) (*[]byte, error) {
 	if id == nil {
@@ -43,31 +55,121 @@ func (db *DB) Save(path string, id *string, content *[]byte) error {
 		return fmt.Errorf("CONTENT_NOT_FOUND")
 	}
 
-	db.checkFolder(path)
-
-	var file *os.File
-	var err error
-	file, err = os.Create("./.db/" + path + *id + ".animenya")
+	tmp, err := db.stage(path, *id, *content)
 	if err != nil {
-		if !os.IsExist(err) {
-			return err
+		return err
+	}
+	defer os.Remove(tmp)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return os.Rename(tmp, db.recordPath(path, *id))
+}
+
+// SaveBatch saves every content keyed by id. Every record is written before
+// any is replaced, so a failed write leaves the stored records untouched, and
+// they are all replaced under the lock, so no other save interleaves with the
+// batch.
+func (db *DB) SaveBatch(path string, contents map[string][]byte) error {
+	staged := map[string]string{}
+	defer func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
 		}
+	}()
 
-		file, err = os.OpenFile("./.db/"+path+*id+".animenya", os.O_RDWR, 0644)
+	for id, content := range contents {
+		tmp, err := db.stage(path, id, content)
 		if err != nil {
 			return err
 		}
+		staged[id] = tmp
 	}
-	defer file.Close()
 
-	_, err = file.Write(*content)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for id, tmp := range staged {
+		if err := os.Rename(tmp, db.recordPath(path, id)); err != nil {
+			return err
+		}
+		delete(staged, id)
+	}
+
+	return nil
+}
+
+// stage writes the content next to the record and returns the temporary file,
+// renaming it over the record replaces it at once so a reader never sees a
+// partially written record.
+func (db *DB) stage(path string, id string, content []byte) (string, error) {
+	db.checkFolder(path)
+
+	file, err := os.CreateTemp("./.db/"+path, "."+id+".*.tmp")
 	if err != nil {
+		return "", err
+	}
+
+	// temporary files are created private, the records are not
+	if err := file.Chmod(recordMode); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func (db *DB) recordPath(path string, id string) string {
+	return "./.db/" + path + id + ".animenya"
+}
+
+// Delete removes the record, a missing record is not an error.
+func (db *DB) Delete(path string, id *string) error {
+	if id == nil {
+		return fmt.Errorf("ID_NOT_FOUND")
+	}
+
+	err := os.Remove("./.db/" + path + *id + ".animenya")
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
 	return nil
 }
 
+func (db *DB) List(path string) ([]string, error) {
+	db.checkFolder(path)
+
+	entries, err := os.ReadDir("./.db/" + path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".animenya") {
+			continue
+		}
+
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".animenya"))
+	}
+
+	return ids, nil
+}
+
 func (db *DB) checkFolder(path string) error {
 	if _, err := os.Stat("./.db"); os.IsNotExist(err) {
 		err = os.Mkdir("./.db", os.ModePerm)
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSave(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	db := New()
+	id := "1"
+	for _, content := range []string{"a longer first record", "short"} {
+		content := []byte(content)
+		if err := db.Save("anime/", &id, &content); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := db.Get("anime/", &id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(*got) != string(content) {
+			t.Errorf("got %q, want %q", *got, content)
+		}
+	}
+
+	info, err := os.Stat("./.db/anime/1.animenya")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != recordMode {
+		t.Errorf("record mode %v, want %v", info.Mode().Perm(), os.FileMode(recordMode))
+	}
+
+	ids, err := db.List("anime/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("temporary files left behind: %v", ids)
+	}
+
+	entries, err := os.ReadDir("./.db/anime/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want 1", len(entries))
+	}
+}
+
+func TestSaveBatch(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	db := New()
+	id := "1"
+	old := []byte("old")
+	if err := db.Save("anime/", &id, &old); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second record cannot be written, so none is replaced
+	err = db.SaveBatch("anime/", map[string][]byte{"1": []byte("new"), "2/3": []byte("unwritable")})
+	if err == nil {
+		t.Fatal("saved a record with an invalid id")
+	}
+
+	got, err := db.Get("anime/", &id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(*got) != "old" {
+		t.Errorf("got %q after a failed batch, want %q", *got, "old")
+	}
+
+	if err := db.SaveBatch("anime/", map[string][]byte{"1": []byte("new"), "2": []byte("second")}); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{"1": "new", "2": "second"} {
+		id := id
+		got, err := db.Get("anime/", &id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(*got) != want {
+			t.Errorf("%s: got %q, want %q", id, *got, want)
+		}
+	}
+
+	entries, err := os.ReadDir("./.db/anime/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d files, want 2", len(entries))
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/gofiber/fiber/v2 v2.41.0
 	github.com/joho/godotenv v1.4.0
 	github.com/rs/zerolog v1.28.0
+	golang.org/x/image v0.18.0
 )
 
 require (
@@ -1,15 +1,14 @@
 package handler
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
-	"animenya.site/data"
 	"animenya.site/model"
+	"animenya.site/stream"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
 )
@@ -21,6 +20,12 @@ func (h *Handler) LatestAnimeEpisode(c *fiber.Ctx) error {
 	}
 	result.Data = []*model.Episode{}
 
+	animeType := model.ParseAnimeType(c.Query("type"))
+	if c.Query("type") != "" && animeType == "" {
+		result.Error = "INVALID_TYPE"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
 	episodes, err := h.Fetcher.GetLatestAnimeEpisode(c.Context(), "")
 	if err != nil {
 		if err.Error() == "NOT_FOUND" {
@@ -35,77 +40,49 @@ func (h *Handler) LatestAnimeEpisode(c *fiber.Ctx) error {
 	}
 
 	for _, episode := range episodes {
-		animeID := strconv.Itoa(episode.Anime.ID)
-		_anime, err := h.DB.Get(data.DBAnime, &animeID)
-		if err != nil {
-			if err.Error() != "NOT_FOUND" {
-				log.Error().Err(err).Msg("anime.AllAnime: failed to get anime from db")
-				continue
+		episode := episode
+		anime, err := h.Catalog.UpdateAnime(episode.Anime.ID, func(existing *model.Anime) (*model.Anime, error) {
+			incoming := model.Anime{
+				ID:       episode.Anime.ID,
+				Slug:     episode.Anime.Slug,
+				Episodes: []*model.Episode{episode},
 			}
-		}
-
-		var anime model.Anime
-		if _anime != nil {
-			if err := json.Unmarshal(*_anime, &anime); err != nil {
-				log.Error().Err(err).Msg("anime.AllAnime: failed to unmarshal anime from db")
-				continue
+			// the post title is only a fallback for unknown anime, the detail
+			// page has the real one
+			if existing.Title == "" {
+				incoming.Title = episode.Anime.Title
 			}
-
-			episode.Anime.ID = anime.ID
-			episode.Anime.Title = anime.Title
-			episode.Anime.Slug = anime.Slug
-			episode.Anime.CoverURL = anime.CoverURL
-
-			if anime.Episodes == nil {
-				anime.Episodes = []*model.Episode{{
-					ID:        episode.ID,
-					Slug:      episode.Slug,
-					Episode:   episode.Episode,
-					CreatedAt: episode.CreatedAt,
-				}}
-			} else if len(anime.Episodes) > 0 {
-				var found bool
-				for _, _episode := range anime.Episodes {
-					if _episode.ID == episode.ID {
-						found = true
-						break
-					}
-				}
-
-				if !found {
-					anime.Episodes = append(anime.Episodes, &model.Episode{
-						ID:        episode.ID,
-						Slug:      episode.Slug,
-						Episode:   episode.Episode,
-						CreatedAt: episode.CreatedAt,
-					})
-				}
+			if existing.Type == "" && episode.Kind == model.EpisodeKindMovie {
+				incoming.Type = model.AnimeTypeMovie
 			}
-		} else {
-			anime.ID = episode.Anime.ID
-			anime.Title = episode.Anime.Title
-			anime.Slug = episode.Anime.Slug
-			anime.CoverURL = episode.Anime.CoverURL
-			anime.Episodes = []*model.Episode{{
-				ID:        episode.ID,
-				Slug:      episode.Slug,
-				Episode:   episode.Episode,
-				CreatedAt: episode.CreatedAt,
-			}}
-
-			episode.Anime = &anime
-		}
 
-		err = anime.Save(h.DB, true)
+			return &incoming, nil
+		})
 		if err != nil {
 			log.Error().Err(err).Msg("anime.AllAnime: failed to save anime to db")
 			continue
 		}
 
-		episode.Anime.CoverURL = fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/cover", anime.ID)
+		episode.Anime = &model.Anime{
+			ID:            anime.ID,
+			Title:         anime.Title,
+			Slug:          anime.Slug,
+			Type:          anime.Type,
+			CoverURL:      fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/cover", anime.ID),
+			CoverBlurhash: anime.CoverBlurhash,
+			CoverColor:    anime.CoverColor,
+		}
+		episode.ThumbnailURL = thumbnailURL(anime.ID, episode)
+	}
+
+	for _, episode := range episodes {
+		if animeType != "" && episode.Anime.Type != animeType {
+			continue
+		}
+
+		result.Data = append(result.Data, episode)
 	}
 
-	result.Data = episodes
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
@@ -115,84 +92,67 @@ func (h *Handler) Anime(c *fiber.Ctx) error {
 		Error any          `json:"error"`
 	}
 
-	animeID := c.Params("anime_id")
-	_anime, err := h.DB.Get(data.DBAnime, &animeID)
+	animeID, err := c.ParamsInt("anime_id")
 	if err != nil {
-		if err.Error() != "NOT_FOUND" {
-			log.Error().Err(err).Msg("anime.Anime: failed to get anime from db")
-			return c.Status(fiber.StatusInternalServerError).JSON(result)
-		}
-	}
-	if _anime == nil {
 		result.Error = "NOT_FOUND"
 		return c.Status(fiber.StatusNotFound).JSON(result)
 	}
 
-	var anime *model.Anime
-	if err := json.Unmarshal(*_anime, &anime); err != nil {
-		log.Error().Err(err).Msg("anime.Anime: failed to unmarshal anime from db")
-		return c.Status(fiber.StatusInternalServerError).JSON(result)
-	}
-
-	if !anime.IsDataComplete() || anime.IsCacheExpired() {
-		_anime, err := h.Fetcher.GetAnimeDetailByAnimeSlug(c.Context(), &anime.Slug)
-		if err != nil {
-			if err.Error() == "NOT_FOUND" {
-				result.Error = "NOT_FOUND"
-				return c.Status(fiber.StatusNotFound).JSON(result)
-			}
-
-			log.Error().Err(err).Msg("anime.Anime: failed to get anime detail")
-			result.Error = "INTERNAL_SERVER_ERROR"
+	anime := &model.Anime{ID: animeID}
+	if err := anime.Get(h.DB); err != nil {
+		if err.Error() != "NOT_FOUND" {
+			log.Error().Err(err).Msg("anime.Anime: failed to get anime from db")
 			return c.Status(fiber.StatusInternalServerError).JSON(result)
 		}
 
-		if _anime == nil {
-			result.Error = "NOT_FOUND"
-			return c.Status(fiber.StatusNotFound).JSON(result)
-		}
+		result.Error = "NOT_FOUND"
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
 
-		anime.PostID = _anime.PostID
-		anime.CoverURL = _anime.CoverURL
-		anime.TrailerURL = _anime.TrailerURL
-		anime.TotalEpisode = _anime.TotalEpisode
-		anime.Studio = _anime.Studio
+	// stale data is served right away and refreshed in the background, unless
+	// the caller asks for fresh data with refresh=sync
+	if anime.IsMetadataStale() || anime.IsEpisodesStale() {
+		if c.Query("refresh") != "sync" {
+			h.Catalog.EnqueueRefresh(anime.ID)
+			c.Response().Header.Add("Cache-Time", "0")
+		} else {
+			anime, err = h.Catalog.RefreshAnime(c.Context(), anime)
+			if err != nil {
+				if err.Error() == "NOT_FOUND" {
+					result.Error = "NOT_FOUND"
+					return c.Status(fiber.StatusNotFound).JSON(result)
+				}
 
-		_anime, err = h.Fetcher.GetAnimeDetailByPostID(c.Context(), _anime.PostID)
-		if err != nil {
-			if err.Error() == "NOT_FOUND" {
-				result.Error = "NOT_FOUND"
-				return c.Status(fiber.StatusNotFound).JSON(result)
+				log.Error().Err(err).Msg("anime.Anime: failed to refresh anime")
+				result.Error = "INTERNAL_SERVER_ERROR"
+				return c.Status(fiber.StatusInternalServerError).JSON(result)
 			}
-
-			log.Error().Err(err).Msg("anime.Anime: failed to get anime detail")
-			result.Error = "INTERNAL_SERVER_ERROR"
-			return c.Status(fiber.StatusInternalServerError).JSON(result)
-		}
-
-		if err := anime.Update(h.DB, _anime); err != nil {
-			log.Error().Err(err).Msg("anime.Anime: failed to update anime to db")
-			result.Error = "INTERNAL_SERVER_ERROR"
-			return c.Status(fiber.StatusInternalServerError).JSON(result)
 		}
 	}
 
 	anime.ReOrderedEpisodes()
 
 	anime.CoverURL = fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/cover", anime.ID)
+	for _, episode := range anime.Episodes {
+		episode.ThumbnailURL = thumbnailURL(anime.ID, episode)
+	}
 	anime.PostID = nil
+	if c.Query("debug") != "true" {
+		anime.StripRaw()
+	}
 	result.Data = anime
-	result.Data.CacheExpireAt = nil
+	result.Data.SchemaVersion = 0
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
 func (h *Handler) AnimeCover(c *fiber.Ctx) error {
-	c.Response().Header.Add("Cache-Time", "0")
-	c.Set("Content-Type", "image/jpeg")
-
-	animeID := c.Params("anime_id")
-	_anime, err := h.DB.Get(data.DBAnime, &animeID)
+	animeID, err := c.ParamsInt("anime_id")
 	if err != nil {
+		return c.Status(fiber.StatusNotFound).Send([]byte{})
+	}
+
+	anime := model.Anime{ID: animeID}
+	if err := anime.Get(h.DB); err != nil {
 		if err.Error() == "NOT_FOUND" {
 			return c.Status(fiber.StatusNotFound).Send([]byte{})
 		}
@@ -201,45 +161,73 @@ func (h *Handler) AnimeCover(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).Send([]byte{})
 	}
 
-	var anime *model.Anime
-	if _anime != nil {
-		if err := json.Unmarshal(*_anime, &anime); err != nil {
-			log.Error().Err(err).Msg("anime.AnimeCover: failed to unmarshal anime from db")
-			return c.Status(fiber.StatusNotFound).Send([]byte{})
-		}
+	opts, err := imageOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
 	if anime.CoverURL == "" {
+		return sendPlaceholder(c, opts, anime.CoverColor, placeholderWidth, placeholderHeight)
+	}
+
+	image, err := h.Images.GetVariant(c.Context(), anime.CoverURL, opts)
+	if err != nil {
+		log.Error().Err(err).Msg("anime.AnimeCover: failed to get cover")
+		return sendPlaceholder(c, opts, anime.CoverColor, placeholderWidth, placeholderHeight)
+	}
+
+	return sendImage(c, image)
+}
+
+func (h *Handler) EpisodeThumbnail(c *fiber.Ctx) error {
+	animeID, err := c.ParamsInt("anime_id")
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).Send([]byte{})
 	}
 
-	req, err := http.NewRequest("GET", anime.CoverURL, nil)
+	episodeID, err := c.ParamsInt("episode_id")
 	if err != nil {
-		log.Error().Err(err).Msg("anime.AnimeCover: failed to create request")
+		return c.Status(fiber.StatusNotFound).Send([]byte{})
+	}
+
+	anime := model.Anime{ID: animeID}
+	if err := anime.Get(h.DB); err != nil {
+		if err.Error() == "NOT_FOUND" {
+			return c.Status(fiber.StatusNotFound).Send([]byte{})
+		}
+
+		log.Error().Err(err).Msg("anime.EpisodeThumbnail: failed to get anime from db")
 		return c.Status(fiber.StatusInternalServerError).Send([]byte{})
 	}
 
-	req.Header.Set("referer", os.Getenv("SOURCE_URL"))
+	var episode *model.Episode
+	for _, _episode := range anime.Episodes {
+		if _episode.ID == episodeID {
+			episode = _episode
+			break
+		}
+	}
+
+	if episode == nil {
+		return c.Status(fiber.StatusNotFound).Send([]byte{})
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	opts, err := imageOptions(c)
 	if err != nil {
-		log.Error().Err(err).Msg("anime.AnimeCover: failed to get cover")
-		return c.Status(fiber.StatusInternalServerError).Send([]byte{})
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		log.Error().Err(err).Msg("anime.AnimeCover: failed to get cover")
-		return c.Status(fiber.StatusInternalServerError).Send([]byte{})
+	if episode.ThumbnailURL == "" {
+		return sendPlaceholder(c, opts, anime.CoverColor, thumbnailWidth, thumbnailHeight)
 	}
 
-	cover, err := io.ReadAll(resp.Body)
+	image, err := h.Images.GetVariant(c.Context(), episode.ThumbnailURL, opts)
 	if err != nil {
-		log.Error().Err(err).Msg("anime.AnimeCover: failed to read cover")
-		return c.Status(fiber.StatusInternalServerError).Send([]byte{})
+		log.Error().Err(err).Msg("anime.EpisodeThumbnail: failed to get thumbnail")
+		return sendPlaceholder(c, opts, anime.CoverColor, thumbnailWidth, thumbnailHeight)
 	}
 
-	return c.Status(fiber.StatusOK).Send(cover)
+	return sendImage(c, image)
 }
 
 func (h *Handler) Episode(c *fiber.Ctx) error {
@@ -286,9 +274,9 @@ func (h *Handler) Episode(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(result)
 	}
 
-	if result.Data.Watches == nil {
-		watches, err := h.Fetcher.GetEpisodeWatchesByEpisodeIDAndEpisodeSlug(c.Context(), &episodeID, &result.Data.Slug)
-		if err != nil {
+	if result.Data.IsWatchesStale(anime.Status) {
+		_anime, err := h.Catalog.RefreshWatches(c.Context(), &anime, episodeID)
+		if err != nil && result.Data.Watches == nil {
 			if err.Error() == "NOT_FOUND" {
 				result.Error = "NOT_FOUND"
 				return c.Status(fiber.StatusNotFound).JSON(result)
@@ -299,47 +287,255 @@ func (h *Handler) Episode(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusInternalServerError).JSON(result)
 		}
 
-		for _, episode := range anime.Episodes {
-			if episode.ID == episodeID {
-				episode.Watches = watches
-				break
+		// stale watches are still better than none when the source fails
+		if err != nil {
+			log.Error().Err(err).Msg("anime.Episode: failed to refresh episode watches")
+		} else {
+			anime = *_anime
+			for _, episode := range anime.Episodes {
+				if episode.ID == episodeID {
+					result.Data = episode
+					break
+				}
 			}
 		}
+	} else if result.Data.WatchesFetchedAt == nil && len(result.Data.Watches) == 0 {
+		// the last fetch failed and is not retried yet, see model.watchesRetryAfter
+		result.Data = nil
+		result.Error = "FAILED_TO_GET_EPISODE_WATCHES"
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
 
-		if err := anime.Save(h.DB, true); err != nil {
-			log.Error().Err(err).Msg("anime.Episode: failed to save episode")
+	result.Data.Watches = model.HealthyWatches(result.Data.Watches)
+	if c.Query("quality") != "" {
+		watches, err := filterWatchesByQuality(result.Data.Watches, c.Query("quality"))
+		if err != nil {
+			result.Data = nil
+			result.Error = err.Error()
+			return c.Status(fiber.StatusBadRequest).JSON(result)
 		}
 		result.Data.Watches = watches
 	}
 
+	result.Data.Subtitles = episodeSubtitles(anime.ID, episodeID, result.Data.Watches)
+	expireAt := time.Now().Add(stream.TokenTTL)
+	for _, watch := range result.Data.Watches {
+		for _, source := range watch.Sources {
+			source.ProxyURL = stream.URL(source.URL, expireAt)
+		}
+	}
+
+	siblings, err := anime.EpisodeSiblings(episodeID)
+	if err != nil {
+		log.Error().Err(err).Msg("anime.Episode: failed to get episode siblings")
+	} else {
+		result.Data.Previous = siblings.Previous
+		result.Data.Next = siblings.Next
+	}
+
 	result.Data.Anime = &model.Anime{}
 	result.Data.Anime.ID = anime.ID
 	result.Data.Anime.Slug = anime.Slug
 	result.Data.Anime.Title = anime.Title
 	result.Data.Anime.CoverURL = fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/cover", anime.ID)
+	result.Data.Anime.CoverBlurhash = anime.CoverBlurhash
+	result.Data.Anime.CoverColor = anime.CoverColor
+	result.Data.ThumbnailURL = thumbnailURL(anime.ID, result.Data)
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) EpisodeSiblings(c *fiber.Ctx) error {
+	var result struct {
+		Data  *model.EpisodeSiblings `json:"data"`
+		Error any                    `json:"error"`
+	}
+
+	animeID, err := c.ParamsInt("anime_id")
+	if err != nil {
+		log.Error().Err(err).Msg("anime.EpisodeSiblings: failed to get anime id")
+		result.Error = "INVALID_ANIME_ID"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	episodeID, err := c.ParamsInt("episode_id")
+	if err != nil {
+		log.Error().Err(err).Msg("anime.EpisodeSiblings: failed to get episode id")
+		result.Error = "INVALID_EPISODE_ID"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	anime := model.Anime{ID: animeID}
+	if err := anime.Get(h.DB); err != nil {
+		if err.Error() != "NOT_FOUND" {
+			log.Error().Err(err).Msg("anime.EpisodeSiblings: failed to get anime from db")
+			result.Error = "INTERNAL_SERVER_ERROR"
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+
+		result.Error = "ANIME_NOT_FOUND"
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	siblings, err := anime.EpisodeSiblings(episodeID)
+	if err != nil {
+		result.Error = err.Error()
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Data = siblings
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
-func (h *Handler) SearchAnime(c *fiber.Ctx) error {
-	c.Response().Header.Add("Cache-Time", "0")
+func (h *Handler) EpisodeDownloads(c *fiber.Ctx) error {
+	var result struct {
+		Data  []*model.Download `json:"data"`
+		Error any               `json:"error"`
+	}
+
+	animeID, err := c.ParamsInt("anime_id")
+	if err != nil {
+		log.Error().Err(err).Msg("anime.EpisodeDownloads: failed to get anime id")
+		result.Error = "INVALID_ANIME_ID"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	episodeID, err := c.ParamsInt("episode_id")
+	if err != nil {
+		log.Error().Err(err).Msg("anime.EpisodeDownloads: failed to get episode id")
+		result.Error = "INVALID_EPISODE_ID"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	anime := model.Anime{ID: animeID}
+	if err := anime.Get(h.DB); err != nil {
+		if err.Error() != "NOT_FOUND" {
+			log.Error().Err(err).Msg("anime.EpisodeDownloads: failed to get anime from db")
+			result.Error = "INTERNAL_SERVER_ERROR"
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+
+		result.Error = "ANIME_NOT_FOUND"
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	var episode *model.Episode
+	for _, _episode := range anime.Episodes {
+		if _episode.ID == episodeID {
+			episode = _episode
+			break
+		}
+	}
+
+	if episode == nil {
+		result.Error = "EPISODE_NOT_FOUND"
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	// downloads are scraped with the watches of the episode page
+	if episode.DownloadsFetchedAt == nil || episode.IsWatchesStale(anime.Status) {
+		_anime, err := h.Catalog.RefreshWatches(c.Context(), &anime, episodeID)
+		if err != nil && episode.DownloadsFetchedAt == nil && episode.Downloads == nil {
+			log.Error().Err(err).Msg("anime.EpisodeDownloads: failed to get episode downloads")
+			result.Error = "FAILED_TO_GET_EPISODE_DOWNLOADS"
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+
+		if err != nil {
+			log.Error().Err(err).Msg("anime.EpisodeDownloads: failed to refresh episode downloads")
+		} else {
+			for _, _episode := range _anime.Episodes {
+				if _episode.ID == episodeID {
+					episode = _episode
+					break
+				}
+			}
+		}
+	}
+
+	result.Data = []*model.Download{}
+	for _, download := range episode.Downloads {
+		if c.Query("format") != "" && !strings.EqualFold(download.Format, c.Query("format")) {
+			continue
+		}
+
+		result.Data = append(result.Data, download)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) Movies(c *fiber.Ctx) error {
 	var result struct {
 		Data  []*model.SimpleAnime `json:"data"`
 		Error any                  `json:"error"`
 	}
 	result.Data = []*model.SimpleAnime{}
 
-	query := c.Query("query")
-	if query == "" || !(len(query) >= 3) {
-		return c.Status(fiber.StatusOK).JSON(result)
-	}
-
-	anime, err := h.Fetcher.GetAnimeBySearch(c.Context(), h.DB, &query)
+	anime, err := model.ListAnime(h.DB)
 	if err != nil {
-		log.Error().Err(err).Msg("anime.SearchAnime: failed to search anime")
-		result.Error = "FAILED_TO_SEARCH_ANIME"
+		log.Error().Err(err).Msg("anime.Movies: failed to list anime from db")
+		result.Error = "INTERNAL_SERVER_ERROR"
 		return c.Status(fiber.StatusInternalServerError).JSON(result)
 	}
 
-	result.Data = anime
+	for _, _anime := range anime {
+		if _anime.Type != model.AnimeTypeMovie {
+			continue
+		}
+
+		result.Data = append(result.Data, simpleAnime(_anime))
+	}
+
 	return c.Status(fiber.StatusOK).JSON(result)
 }
+
+// filterWatchesByQuality keeps the watches of the comma separated qualities,
+// "best" keeps the highest quality available. The watches order is kept.
+func filterWatchesByQuality(watches []*model.Watch, query string) ([]*model.Watch, error) {
+	qualities := map[string]bool{}
+	for _, quality := range strings.Split(query, ",") {
+		quality = strings.ToLower(strings.TrimSpace(quality))
+		if quality == "best" {
+			best := -1
+			for _, watch := range watches {
+				if model.QualityRank(watch.Quality) > best {
+					best = model.QualityRank(watch.Quality)
+				}
+			}
+			if best >= 0 {
+				qualities[model.Qualities[best]] = true
+			} else {
+				qualities[""] = true
+			}
+			continue
+		}
+
+		if _, err := strconv.Atoi(quality); err == nil {
+			quality += "p"
+		}
+		if model.QualityRank(quality) < 0 {
+			return nil, fmt.Errorf("INVALID_QUALITY")
+		}
+
+		qualities[quality] = true
+	}
+
+	result := []*model.Watch{}
+	for _, watch := range watches {
+		if qualities[watch.Quality] {
+			result = append(result, watch)
+		}
+	}
+
+	return result, nil
+}
+
+// thumbnailURL returns the thumbnail endpoint of the episode, empty when the
+// source has no screenshot of it.
+func thumbnailURL(animeID int, episode *model.Episode) string {
+	if episode.ThumbnailURL == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/episode/%d/thumbnail", animeID, episode.ID)
+}
@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"animenya.site/catalog"
+	"animenya.site/db"
+	"animenya.site/lib"
+	"animenya.site/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeFetcher serves the anime detail from memory and counts the calls, the
+// methods the tests do not expect panic on the nil interface.
+type fakeFetcher struct {
+	lib.FetcherInterface
+	detail   *model.Anime
+	episodes []*model.Episode
+	// episodeErr fails the episode fetches, which otherwise find no watch
+	// and only the downloads
+	episodeErr error
+	downloads  []*model.Download
+	calls      int
+}
+
+func (f *fakeFetcher) GetEpisodeByEpisodeIDAndEpisodeSlug(ctx context.Context, episodeID *int, episodeSlug *string) (*model.Episode, error) {
+	f.calls++
+	if f.episodeErr != nil {
+		return nil, f.episodeErr
+	}
+
+	now := time.Now()
+	return &model.Episode{ID: *episodeID, WatchesFetchedAt: &now, Watches: []*model.Watch{}, DownloadsFetchedAt: &now, Downloads: f.downloads}, nil
+}
+
+func (f *fakeFetcher) GetLatestAnimeEpisode(ctx context.Context, params string) ([]*model.Episode, error) {
+	f.calls++
+	return f.episodes, nil
+}
+
+func (f *fakeFetcher) GetAnimeDetailByAnimeSlug(ctx context.Context, animeSlug *string) (*model.Anime, error) {
+	f.calls++
+	return &model.Anime{PostID: f.detail.PostID, Title: f.detail.Title}, nil
+}
+
+func (f *fakeFetcher) GetAnimeDetailByPostID(ctx context.Context, postID *int) (*model.Anime, error) {
+	f.calls++
+	return &model.Anime{Episodes: f.detail.Episodes}, nil
+}
+
+// newTestHandler runs the handler on a db in a temporary directory, the
+// refresh queue has no worker so queued refreshes are only recorded.
+func newTestHandler(t *testing.T, fetch *fakeFetcher) (*fiber.App, db.DBInterface) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	db := db.New()
+	catalog := catalog.New(db, fetch, nil)
+	catalog.Start(0)
+
+	handler := New(fetch, db, nil, catalog, nil)
+	app := fiber.New()
+	app.Get("/anime", handler.LatestAnimeEpisode)
+	app.Get("/anime/:anime_id", handler.Anime)
+	app.Get("/anime/:anime_id/episode/:episode_id", handler.Episode)
+	app.Get("/anime/:anime_id/episode/:episode_id/downloads", handler.EpisodeDownloads)
+	return app, db
+}
+
+func TestAnime(t *testing.T) {
+	postID := 100
+	fresh := time.Now()
+	expired := time.Now().Add(-time.Hour * 24 * 365)
+	detail := &model.Anime{
+		PostID:   &postID,
+		Title:    "Fetched",
+		Episodes: []*model.Episode{{ID: 10, Slug: "fetched-episode-1"}},
+	}
+
+	tests := []struct {
+		name   string
+		stored *model.Anime
+		query  string
+		status int
+		// title is the title served, calls the upstream fetches made in the
+		// request and queued whether a background refresh was queued
+		title  string
+		calls  int
+		queued bool
+	}{
+		{
+			name:   "missing record",
+			status: fiber.StatusNotFound,
+		},
+		{
+			name:   "incomplete record is served and refreshed in the background",
+			stored: &model.Anime{ID: 1, Slug: "stored", Title: "Stored"},
+			status: fiber.StatusOK,
+			title:  "Stored",
+			queued: true,
+		},
+		{
+			name:   "expired record is served and refreshed in the background",
+			stored: &model.Anime{ID: 1, Slug: "stored", Title: "Stored", PostID: &postID, MetadataFetchedAt: &expired, EpisodesFetchedAt: &expired},
+			status: fiber.StatusOK,
+			title:  "Stored",
+			queued: true,
+		},
+		{
+			name:   "expired record is refreshed in the request with refresh=sync",
+			stored: &model.Anime{ID: 1, Slug: "stored", Title: "Stored", PostID: &postID, MetadataFetchedAt: &expired, EpisodesFetchedAt: &expired},
+			query:  "?refresh=sync",
+			status: fiber.StatusOK,
+			title:  "Fetched",
+			calls:  2,
+		},
+		{
+			name:   "fresh record is served as is",
+			stored: &model.Anime{ID: 1, Slug: "stored", Title: "Stored", PostID: &postID, MetadataFetchedAt: &fresh, EpisodesFetchedAt: &fresh},
+			status: fiber.StatusOK,
+			title:  "Stored",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetch := &fakeFetcher{detail: detail}
+			app, db := newTestHandler(t, fetch)
+			if test.stored != nil {
+				if err := test.stored.Save(db); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/anime/1"+test.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, test.status)
+			}
+			if fetch.calls != test.calls {
+				t.Errorf("%d upstream fetches, want %d", fetch.calls, test.calls)
+			}
+			if queued := resp.Header.Get("Cache-Time") == "0"; queued != test.queued {
+				t.Errorf("refresh queued %v, want %v", queued, test.queued)
+			}
+
+			var result struct {
+				Data  *model.Anime `json:"data"`
+				Error any          `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if test.status != fiber.StatusOK {
+				if result.Error != "NOT_FOUND" {
+					t.Errorf("error %v, want NOT_FOUND", result.Error)
+				}
+				return
+			}
+			if result.Data.Title != test.title {
+				t.Errorf("title %q, want %q", result.Data.Title, test.title)
+			}
+			if result.Data.PostID != nil {
+				t.Error("post id is exposed")
+			}
+		})
+	}
+}
+
+func TestFilterWatchesByQuality(t *testing.T) {
+	watches := []*model.Watch{
+		{ID: 1, Quality: "360p"},
+		{ID: 2, Quality: "720p"},
+		{ID: 3, Quality: "1080p"},
+		{ID: 4, Quality: "720p"},
+		{ID: 5},
+	}
+
+	tests := []struct {
+		query   string
+		watches []*model.Watch
+		want    []int
+		err     string
+	}{
+		{query: "720p", watches: watches, want: []int{2, 4}},
+		{query: "720", watches: watches, want: []int{2, 4}},
+		{query: " 360P , 1080p", watches: watches, want: []int{1, 3}},
+		{query: "best", watches: watches, want: []int{3}},
+		{query: "best,360", watches: watches, want: []int{1, 3}},
+		{query: "best", watches: []*model.Watch{{ID: 5}}, want: []int{5}},
+		{query: "2160p", watches: watches, want: []int{}},
+		{query: "hd", watches: watches, err: "INVALID_QUALITY"},
+		{query: "999", watches: watches, err: "INVALID_QUALITY"},
+	}
+
+	for _, test := range tests {
+		got, err := filterWatchesByQuality(test.watches, test.query)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: error %v, want %s", test.query, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+
+		ids := []int{}
+		for _, watch := range got {
+			ids = append(ids, watch.ID)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("%q: got %v, want %v", test.query, ids, test.want)
+		}
+	}
+}
+
+func TestLatestAnimeEpisodeType(t *testing.T) {
+	latest := func() []*model.Episode {
+		return []*model.Episode{
+			{ID: 11, Kind: model.EpisodeKindMovie, Anime: &model.Anime{ID: 1, Slug: "movie", Title: "Movie"}},
+			{ID: 21, Kind: model.EpisodeKindEpisode, Anime: &model.Anime{ID: 2, Slug: "series", Title: "Series"}},
+			{ID: 31, Kind: model.EpisodeKindEpisode, Anime: &model.Anime{ID: 3, Slug: "unknown", Title: "Unknown"}},
+		}
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		want   []int
+	}{
+		{query: "", status: fiber.StatusOK, want: []int{11, 21, 31}},
+		{query: "?type=movie", status: fiber.StatusOK, want: []int{11}},
+		{query: "?type=TV", status: fiber.StatusOK, want: []int{21}},
+		{query: "?type=ova", status: fiber.StatusOK, want: []int{}},
+		{query: "?type=music", status: fiber.StatusBadRequest, want: []int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			fetch := &fakeFetcher{episodes: latest()}
+			app, db := newTestHandler(t, fetch)
+			// the type of a known anime comes from its stored detail
+			series := model.Anime{ID: 2, Type: model.AnimeTypeTV}
+			if err := series.Save(db); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/anime"+test.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, test.status)
+			}
+
+			var result struct {
+				Data  []*model.Episode `json:"data"`
+				Error any              `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int{}
+			for _, episode := range result.Data {
+				ids = append(ids, episode.ID)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("got %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestEpisodeWithoutWatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		episodeErr error
+		status     int
+	}{
+		{"fetched without any watch", nil, fiber.StatusOK},
+		{"failed fetch", fmt.Errorf("STATUS_CODE_NOT_OK"), fiber.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetch := &fakeFetcher{episodeErr: test.episodeErr}
+			app, db := newTestHandler(t, fetch)
+			anime := model.Anime{ID: 1, Episodes: []*model.Episode{{ID: 10, Slug: "episode-1"}}}
+			if err := anime.Save(db); err != nil {
+				t.Fatal(err)
+			}
+
+			// the second request neither scrapes again nor hides the failure
+			for i := 0; i < 2; i++ {
+				resp, err := app.Test(httptest.NewRequest("GET", "/anime/1/episode/10", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != test.status {
+					t.Errorf("request %d: status %d, want %d", i, resp.StatusCode, test.status)
+				}
+			}
+			if fetch.calls != 1 {
+				t.Errorf("%d upstream fetches, want 1", fetch.calls)
+			}
+		})
+	}
+}
+
+func TestEpisodeDownloadsWithoutWatches(t *testing.T) {
+	fetch := &fakeFetcher{downloads: []*model.Download{
+		{Format: "mkv", Quality: "480p", Host: "gofile.io", URL: "https://gofile.io/d/batch480"},
+		{Format: "mp4", Quality: "720p", Host: "pixeldrain.com", URL: "https://pixeldrain.com/u/batch720"},
+	}}
+	app, db := newTestHandler(t, fetch)
+	anime := model.Anime{ID: 1, Episodes: []*model.Episode{{ID: 10, Slug: "episode-1-12"}}}
+	if err := anime.Save(db); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/anime/1/episode/10/downloads?format=mkv", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var result struct {
+		Data  []*model.Download `json:"data"`
+		Error any               `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Data) != 1 || result.Data[0].URL != "https://gofile.io/d/batch480" {
+		t.Errorf("got %+v, want the mkv download", result.Data)
+	}
+}
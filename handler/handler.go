@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"animenya.site/catalog"
 	"animenya.site/db"
+	"animenya.site/imagecache"
 	"animenya.site/lib"
+	"animenya.site/search"
 )
 
 type HandlerInterface interface {
@@ -12,11 +15,17 @@ type HandlerInterface interface {
 type Handler struct {
 	Fetcher lib.FetcherInterface
 	DB      db.DBInterface
+	Index   *search.Index
+	Catalog *catalog.Catalog
+	Images  *imagecache.Cache
 }
 
-func New(fetch lib.FetcherInterface, db db.DBInterface) *Handler {
+func New(fetch lib.FetcherInterface, db db.DBInterface, index *search.Index, catalog *catalog.Catalog, images *imagecache.Cache) *Handler {
 	return &Handler{
 		Fetcher: fetch,
 		DB:      db,
+		Index:   index,
+		Catalog: catalog,
+		Images:  images,
 	}
 }
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"animenya.site/imagecache"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// imageMaxAge is how long clients may reuse an image without revalidating it
+	imageMaxAge = "public, max-age=86400"
+	// placeholderMaxAge is short so the real image is tried again soon
+	placeholderMaxAge = "public, max-age=300"
+	// placeholderWidth and placeholderHeight are the size of a cover placeholder
+	// without size params, covers are 2:3
+	placeholderWidth  = 300
+	placeholderHeight = 450
+	// thumbnailWidth and thumbnailHeight are the same for episode thumbnails,
+	// which are 16:9 screenshots
+	thumbnailWidth  = 480
+	thumbnailHeight = 270
+)
+
+// sendImage streams the cached image, answering conditional requests with
+// 304 since the ETag is the content hash.
+func sendImage(c *fiber.Ctx, image *imagecache.Image) error {
+	etag := `"` + image.Hash + `"`
+	lastModified := image.FetchedAt.UTC().Truncate(time.Second)
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	c.Set(fiber.HeaderCacheControl, imageMaxAge)
+
+	if notModified(c, etag, lastModified) {
+		image.File.Close()
+		return c.Status(fiber.StatusNotModified).Send([]byte{})
+	}
+
+	// the file is closed by fasthttp once it is sent
+	c.Set(fiber.HeaderContentType, image.ContentType)
+	c.Status(fiber.StatusOK)
+	c.Context().SetBodyStream(image.File, int(image.Size))
+	return nil
+}
+
+// sendPlaceholder sends a plain image of the color instead of an error, so
+// clients never show a broken image. The default size sets the ratio when a
+// single dimension is requested.
+func sendPlaceholder(c *fiber.Ctx, opts imagecache.Options, color string, defaultWidth int, defaultHeight int) error {
+	width, height := opts.Width, opts.Height
+	switch {
+	case width == 0 && height == 0:
+		width, height = defaultWidth, defaultHeight
+	case width == 0:
+		width = height * defaultWidth / defaultHeight
+	case height == 0:
+		height = width * defaultHeight / defaultWidth
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	placeholder, contentType := imagecache.Placeholder(width, height, color, opts.Format)
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, placeholderMaxAge)
+	c.Set("X-Placeholder", "true")
+	return c.Status(fiber.StatusOK).Send(placeholder)
+}
+
+func notModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if header := c.Get(fiber.HeaderIfNoneMatch); header != "" {
+		for _, match := range strings.Split(header, ",") {
+			match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+			if match == etag || match == "*" {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince))
+	return err == nil && !lastModified.After(since)
+}
+
+// imageOptions reads the resize and format params, e.g. ?w=300&fit=cover.
+func imageOptions(c *fiber.Ctx) (imagecache.Options, error) {
+	var opts imagecache.Options
+	for param, value := range map[string]*int{"w": &opts.Width, "h": &opts.Height} {
+		if c.Query(param) == "" {
+			continue
+		}
+
+		dimension, err := strconv.Atoi(c.Query(param))
+		if err != nil || dimension <= 0 || dimension > imagecache.MaxDimension {
+			return opts, fmt.Errorf("INVALID_DIMENSION")
+		}
+		*value = dimension
+	}
+
+	opts.Fit = imagecache.ParseFit(c.Query("fit"))
+	if opts.Fit == "" {
+		return opts, fmt.Errorf("INVALID_FIT")
+	}
+
+	opts.Format = imagecache.ParseFormat(c.Query("format"))
+	if c.Query("format") != "" && opts.Format == "" {
+		return opts, fmt.Errorf("INVALID_FORMAT")
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"animenya.site/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// reportReasonMaxLength is the maximum length of the reason sent by a client
+const reportReasonMaxLength = 200
+
+func (h *Handler) ReportWatch(c *fiber.Ctx) error {
+	var result struct {
+		Data  *model.WatchReport `json:"data"`
+		Error any                `json:"error"`
+	}
+
+	animeID, err := c.ParamsInt("anime_id")
+	if err != nil {
+		log.Error().Err(err).Msg("report.ReportWatch: failed to get anime id")
+		result.Error = "INVALID_ANIME_ID"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	episodeID, err := c.ParamsInt("episode_id")
+	if err != nil {
+		log.Error().Err(err).Msg("report.ReportWatch: failed to get episode id")
+		result.Error = "INVALID_EPISODE_ID"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	watchID, err := c.ParamsInt("watch_id")
+	if err != nil {
+		log.Error().Err(err).Msg("report.ReportWatch: failed to get watch id")
+		result.Error = "INVALID_WATCH_ID"
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			result.Error = "INVALID_BODY"
+			return c.Status(fiber.StatusBadRequest).JSON(result)
+		}
+	}
+
+	reason := strings.TrimSpace(body.Reason)
+	if len(reason) > reportReasonMaxLength {
+		reason = reason[:reportReasonMaxLength]
+	}
+
+	anime := model.Anime{ID: animeID}
+	if err := anime.Get(h.DB); err != nil {
+		if err.Error() != "NOT_FOUND" {
+			log.Error().Err(err).Msg("report.ReportWatch: failed to get anime from db")
+			result.Error = "INTERNAL_SERVER_ERROR"
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+
+		result.Error = "ANIME_NOT_FOUND"
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	report, err := h.Catalog.ReportWatch(&anime, episodeID, watchID, h.ClientIP(c), reason)
+	if err != nil {
+		if err.Error() == "WATCH_NOT_FOUND" {
+			result.Error = "WATCH_NOT_FOUND"
+			return c.Status(fiber.StatusNotFound).JSON(result)
+		}
+
+		log.Error().Err(err).Msg("report.ReportWatch: failed to report watch")
+		result.Error = "FAILED_TO_REPORT_WATCH"
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	// clients only need to know the report went through
+	result.Data = &model.WatchReport{
+		ID:          report.ID,
+		AnimeID:     report.AnimeID,
+		EpisodeID:   report.EpisodeID,
+		WatchID:     report.WatchID,
+		Status:      report.Status,
+		RescrapedAt: report.RescrapedAt,
+	}
+	return c.Status(fiber.StatusAccepted).JSON(result)
+}
+
+// Reports lists every reported watch, it requires the ADMIN_TOKEN env as a
+// bearer token.
+func (h *Handler) Reports(c *fiber.Ctx) error {
+	var result struct {
+		Data  []*model.WatchReport `json:"data"`
+		Error any                  `json:"error"`
+	}
+
+	c.Response().Header.Add("Cache-Time", "0")
+	if !isAdmin(c) {
+		result.Error = "UNAUTHORIZED"
+		return c.Status(fiber.StatusUnauthorized).JSON(result)
+	}
+
+	reports, err := model.ListWatchReports(h.DB)
+	if err != nil {
+		log.Error().Err(err).Msg("report.Reports: failed to list reports")
+		result.Error = "INTERNAL_SERVER_ERROR"
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if status := c.Query("status"); status != "" {
+		var filtered []*model.WatchReport
+		for _, report := range reports {
+			if string(report.Status) == status {
+				filtered = append(filtered, report)
+			}
+		}
+		reports = filtered
+	}
+
+	result.Data = reports
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// DismissReport closes a report without scraping the watch again, it requires
+// the ADMIN_TOKEN env as a bearer token.
+func (h *Handler) DismissReport(c *fiber.Ctx) error {
+	var result struct {
+		Data  *model.WatchReport `json:"data"`
+		Error any                `json:"error"`
+	}
+
+	c.Response().Header.Add("Cache-Time", "0")
+	if !isAdmin(c) {
+		result.Error = "UNAUTHORIZED"
+		return c.Status(fiber.StatusUnauthorized).JSON(result)
+	}
+
+	report, err := h.Catalog.DismissReport(c.Params("report_id"))
+	if err != nil {
+		if err.Error() == "NOT_FOUND" {
+			result.Error = "REPORT_NOT_FOUND"
+			return c.Status(fiber.StatusNotFound).JSON(result)
+		}
+
+		log.Error().Err(err).Msg("report.DismissReport: failed to dismiss report")
+		result.Error = "INTERNAL_SERVER_ERROR"
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Data = report
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// isAdmin reports whether the request carries the ADMIN_TOKEN env as a bearer
+// token, the admin routes are disabled while it is not set.
+func isAdmin(c *fiber.Ctx) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	return token != "" && c.Get(fiber.HeaderAuthorization) == "Bearer "+token
+}
+
+// ClientIP returns the address of the client for the report limits. Behind a
+// trusted proxy it is the last address of the proxy header that is not a
+// trusted proxy, the addresses before it are sent by the client and can be
+// forged.
+func (h *Handler) ClientIP(c *fiber.Ctx) string {
+	header := c.App().Config().ProxyHeader
+	if header == "" || !c.IsProxyTrusted() {
+		return c.IP()
+	}
+
+	var ips []string
+	for _, ip := range strings.Split(c.Get(header), ",") {
+		if ip = strings.TrimSpace(ip); net.ParseIP(ip) != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return c.IP()
+	}
+
+	trusted := c.App().Config().TrustedProxies
+	for i := len(ips) - 1; i > 0; i-- {
+		if !isTrustedProxy(ips[i], trusted) {
+			return ips[i]
+		}
+	}
+
+	return ips[0]
+}
+
+func isTrustedProxy(ip string, trusted []string) bool {
+	parsed := net.ParseIP(ip)
+	for _, proxy := range trusted {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if parsed != nil && network.Contains(parsed) {
+				return true
+			}
+		} else if proxy == ip {
+			return true
+		}
+	}
+
+	return false
+}
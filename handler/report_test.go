@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestClientIP(t *testing.T) {
+	h := &Handler{}
+	newApp := func(trustedProxies []string) *fiber.App {
+		app := fiber.New(fiber.Config{
+			ProxyHeader:             fiber.HeaderXForwardedFor,
+			EnableTrustedProxyCheck: true,
+			TrustedProxies:          trustedProxies,
+			EnableIPValidation:      true,
+		})
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString(h.ClientIP(c))
+		})
+		return app
+	}
+
+	// the test requests come from 0.0.0.0
+	trusted := newApp([]string{"0.0.0.0", "10.0.0.0/8"})
+	untrusted := newApp(nil)
+
+	tests := []struct {
+		name   string
+		app    *fiber.App
+		header string
+		want   string
+	}{
+		{"untrusted peer", untrusted, "1.1.1.1", "0.0.0.0"},
+		{"trusted peer", trusted, "1.1.1.1", "1.1.1.1"},
+		{"forged addresses before the client", trusted, "6.6.6.6, 1.1.1.1", "1.1.1.1"},
+		{"chain of trusted proxies", trusted, "6.6.6.6, 1.1.1.1, 10.0.0.2", "1.1.1.1"},
+		{"no header", trusted, "", "0.0.0.0"},
+		{"invalid header", trusted, "unknown", "0.0.0.0"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			req.Header.Set(fiber.HeaderXForwardedFor, test.header)
+		}
+
+		resp, err := test.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, body, test.want)
+		}
+	}
+}
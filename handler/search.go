@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"animenya.site/model"
+	"animenya.site/search"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	searchLimit           = 50
+	searchUpstreamTimeout = time.Second * 3
+	suggestLimit          = 10
+	suggestMaxLimit       = 20
+)
+
+func (h *Handler) SearchAnime(c *fiber.Ctx) error {
+	c.Response().Header.Add("Cache-Time", "0")
+	var result struct {
+		Data  []*model.SimpleAnime `json:"data"`
+		Error any                  `json:"error"`
+	}
+	result.Data = []*model.SimpleAnime{}
+
+	opts, err := searchOptions(c)
+	if err != nil {
+		result.Error = err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	// without a query, a filter or a sort browses the catalog
+	query := c.Query("query")
+	if query == "" && (!opts.Filter.IsEmpty() || c.Query("sort") != "") {
+		for _, r := range h.Index.Browse(opts) {
+			result.Data = append(result.Data, simpleAnime(r.Anime))
+		}
+
+		return c.Status(fiber.StatusOK).JSON(result)
+	}
+
+	if utf8.RuneCountInString(query) < 3 {
+		return c.Status(fiber.StatusOK).JSON(result)
+	}
+
+	// the upstream hits are saved first, so they are part of the local
+	// results below and get ranked together with the rest of the catalog
+	ctx, cancel := context.WithTimeout(c.Context(), searchUpstreamTimeout)
+	defer cancel()
+	upstream, err := h.Fetcher.GetAnimeBySearch(ctx, &query)
+	if err != nil {
+		log.Error().Err(err).Msg("anime.SearchAnime: failed to search anime upstream, using local index")
+	} else if _, err := h.Catalog.SaveSearchResults(upstream); err != nil {
+		log.Error().Err(err).Msg("anime.SearchAnime: failed to save search results")
+	}
+
+	local := h.Index.Search(query, opts)
+	if err != nil && len(local) == 0 {
+		result.Error = "FAILED_TO_SEARCH_ANIME"
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	found := map[int]bool{}
+	for _, r := range local {
+		found[r.Anime.ID] = true
+		result.Data = append(result.Data, simpleAnime(r.Anime))
+	}
+
+	// upstream hits missing from the index have no metadata to filter on, nor
+	// a rank to page through, they are only added to the first page
+	if opts.Filter.IsEmpty() && opts.Sort == search.SortRelevance && opts.Offset == 0 {
+		for _, _anime := range upstream {
+			if found[_anime.ID] {
+				continue
+			}
+			result.Data = append(result.Data, simpleAnime(_anime))
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// searchOptions reads the filters and sorting of a search from the query
+// params, list params like genre are comma separated.
+func searchOptions(c *fiber.Ctx) (search.Options, error) {
+	opts := search.Options{
+		Limit: searchLimit,
+		Fuzzy: c.Query("fuzzy") == "true",
+		Sort:  search.ParseSort(c.Query("sort")),
+	}
+	if opts.Sort == "" {
+		return opts, fmt.Errorf("INVALID_SORT")
+	}
+
+	opts.Filter.Genres = splitQuery(c.Query("genre"))
+	opts.Filter.ExcludeGenres = splitQuery(c.Query("exclude_genre"))
+	opts.Filter.Season = c.Query("season")
+	opts.Filter.Studio = c.Query("studio")
+
+	if c.Query("type") != "" {
+		opts.Filter.Type = model.ParseAnimeType(c.Query("type"))
+		if opts.Filter.Type == "" {
+			return opts, fmt.Errorf("INVALID_TYPE")
+		}
+	}
+
+	if c.Query("status") != "" {
+		opts.Filter.Status = model.ParseAnimeStatus(c.Query("status"))
+		if opts.Filter.Status == "" {
+			return opts, fmt.Errorf("INVALID_STATUS")
+		}
+	}
+
+	if c.Query("year") != "" {
+		year, err := strconv.Atoi(c.Query("year"))
+		if err != nil {
+			return opts, fmt.Errorf("INVALID_YEAR")
+		}
+		opts.Filter.Year = year
+	}
+
+	for param, score := range map[string]*float64{"min_score": &opts.Filter.MinScore, "max_score": &opts.Filter.MaxScore} {
+		if c.Query(param) == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(c.Query(param), 64)
+		if err != nil {
+			return opts, fmt.Errorf("INVALID_SCORE")
+		}
+		*score = value
+	}
+
+	if c.Query("page") != "" {
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			return opts, fmt.Errorf("INVALID_PAGE")
+		}
+		opts.Offset = (page - 1) * opts.Limit
+	}
+
+	return opts, nil
+}
+
+func splitQuery(str string) []string {
+	var result []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func (h *Handler) SuggestAnime(c *fiber.Ctx) error {
+	c.Response().Header.Add("Cache-Time", "60")
+	var result struct {
+		Data  []*model.SimpleAnime `json:"data"`
+		Error any                  `json:"error"`
+	}
+	result.Data = []*model.SimpleAnime{}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 || limit > suggestMaxLimit {
+		limit = suggestLimit
+	}
+
+	for _, doc := range h.Index.Suggest(c.Query("q"), limit) {
+		result.Data = append(result.Data, simpleAnime(doc.Anime))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func simpleAnime(anime *model.Anime) *model.SimpleAnime {
+	return &model.SimpleAnime{
+		AnimeID:       anime.ID,
+		CoverURL:      fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/cover", anime.ID),
+		CoverBlurhash: anime.CoverBlurhash,
+		CoverColor:    anime.CoverColor,
+		Title:         anime.Title,
+		Type:          anime.Type,
+	}
+}
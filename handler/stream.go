@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"animenya.site/stream"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// maxPlaylistSize is the maximum size of a playlist rewritten by the proxy
+const maxPlaylistSize = 4 << 20
+
+// streamClient has no overall timeout since a segment or a whole mp4 is
+// streamed to the client after the handler returns. It never connects to a
+// private address, even through a redirect, see stream.DialControl.
+var streamClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: time.Second * 10, Control: stream.DialControl}).DialContext,
+		ResponseHeaderTimeout: time.Second * 15,
+		IdleConnTimeout:       time.Minute,
+		MaxIdleConnsPerHost:   16,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("TOO_MANY_REDIRECTS")
+		}
+
+		return stream.CheckURL(req.URL)
+	},
+}
+
+// streamHeaders are copied from the media host response.
+var streamHeaders = []string{
+	fiber.HeaderContentType,
+	fiber.HeaderContentRange,
+	fiber.HeaderAcceptRanges,
+	fiber.HeaderLastModified,
+	fiber.HeaderETag,
+}
+
+// Stream proxies a media URL signed by stream.Sign, sending the Referer its
+// host expects. HLS playlists are rewritten so their segments go through the
+// proxy too, anything else is streamed as is with range support.
+func (h *Handler) Stream(c *fiber.Ctx) error {
+	mediaURL, expireAt, err := stream.Verify(c.Params("token"))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).Send([]byte{})
+	}
+
+	req, err := http.NewRequestWithContext(c.Context(), c.Method(), mediaURL, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("stream.Stream: failed to create request")
+		return c.Status(fiber.StatusInternalServerError).Send([]byte{})
+	}
+	if err := stream.CheckURL(req.URL); err != nil {
+		return c.Status(fiber.StatusForbidden).Send([]byte{})
+	}
+
+	req.Header.Set("referer", os.Getenv("SOURCE_URL"))
+	for _, header := range []string{fiber.HeaderRange, fiber.HeaderIfRange, fiber.HeaderUserAgent} {
+		if value := c.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Msg("stream.Stream: failed to get media")
+		return c.Status(fiber.StatusBadGateway).Send([]byte{})
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return c.Status(fiber.StatusRequestedRangeNotSatisfiable).Send([]byte{})
+		}
+
+		log.Error().Int("status_code", resp.StatusCode).Msg("stream.Stream: failed to get media")
+		return c.Status(fiber.StatusBadGateway).Send([]byte{})
+	}
+
+	if stream.IsPlaylist(resp.Header.Get(fiber.HeaderContentType), mediaURL) {
+		defer resp.Body.Close()
+
+		playlist, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+		if err != nil {
+			log.Error().Err(err).Msg("stream.Stream: failed to read playlist")
+			return c.Status(fiber.StatusBadGateway).Send([]byte{})
+		}
+
+		// segments are relative to the playlist URL after redirects
+		c.Set(fiber.HeaderContentType, "application/vnd.apple.mpegurl")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		return c.Status(fiber.StatusOK).SendString(stream.RewritePlaylist(string(playlist), resp.Request.URL, expireAt))
+	}
+
+	for _, header := range streamHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			c.Set(header, value)
+		}
+	}
+
+	// the body is closed by fasthttp once it is sent
+	c.Status(resp.StatusCode)
+	c.Context().SetBodyStream(resp.Body, int(resp.ContentLength))
+	return nil
+}
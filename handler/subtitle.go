@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"animenya.site/data"
+	"animenya.site/model"
+	"animenya.site/subtitle"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// Subtitle serves the subtitle track of the episode in the language as
+// WebVTT, converted once and cached by its upstream URL.
+func (h *Handler) Subtitle(c *fiber.Ctx) error {
+	animeID, err := c.ParamsInt("anime_id")
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).Send([]byte{})
+	}
+
+	episodeID, err := c.ParamsInt("episode_id")
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).Send([]byte{})
+	}
+
+	anime := model.Anime{ID: animeID}
+	if err := anime.Get(h.DB); err != nil {
+		if err.Error() == "NOT_FOUND" {
+			return c.Status(fiber.StatusNotFound).Send([]byte{})
+		}
+
+		log.Error().Err(err).Msg("subtitle.Subtitle: failed to get anime from db")
+		return c.Status(fiber.StatusInternalServerError).Send([]byte{})
+	}
+
+	var track *model.Subtitle
+	for _, episode := range anime.Episodes {
+		if episode.ID != episodeID {
+			continue
+		}
+
+		for _, watch := range model.HealthyWatches(episode.Watches) {
+			for _, _track := range watch.Subtitles {
+				if _track.Language == c.Params("lang") {
+					track = _track
+					break
+				}
+			}
+			if track != nil {
+				break
+			}
+		}
+	}
+
+	if track == nil {
+		return c.Status(fiber.StatusNotFound).Send([]byte{})
+	}
+
+	sum := sha256.Sum256([]byte(track.URL))
+	id := hex.EncodeToString(sum[:16])
+	content, err := h.DB.Get(data.DBSubtitle, &id)
+	if err != nil {
+		if err.Error() != "NOT_FOUND" {
+			log.Error().Err(err).Msg("subtitle.Subtitle: failed to get subtitle from db")
+			return c.Status(fiber.StatusInternalServerError).Send([]byte{})
+		}
+
+		raw, err := subtitle.Download(c.Context(), track.URL)
+		if err != nil {
+			log.Error().Err(err).Msg("subtitle.Subtitle: failed to download subtitle")
+			return c.Status(fiber.StatusBadGateway).Send([]byte{})
+		}
+
+		vtt, err := subtitle.ToVTT(raw, track.Format)
+		if err != nil {
+			log.Error().Err(err).Msg("subtitle.Subtitle: failed to convert subtitle")
+			return c.Status(fiber.StatusBadGateway).Send([]byte{})
+		}
+
+		if err := h.DB.Save(data.DBSubtitle, &id, &vtt); err != nil {
+			log.Error().Err(err).Msg("subtitle.Subtitle: failed to save subtitle")
+		}
+		content = &vtt
+	}
+
+	c.Set(fiber.HeaderContentType, "text/vtt; charset=utf-8")
+	return c.Status(fiber.StatusOK).Send(*content)
+}
+
+// episodeSubtitles lists a track per language of the watches, in the order
+// of the watches, pointing to the Subtitle endpoint.
+func episodeSubtitles(animeID int, episodeID int, watches []*model.Watch) []*model.Subtitle {
+	var result []*model.Subtitle
+	found := map[string]bool{}
+	for _, watch := range watches {
+		for _, track := range watch.Subtitles {
+			if found[track.Language] {
+				continue
+			}
+
+			found[track.Language] = true
+			result = append(result, &model.Subtitle{
+				Language: track.Language,
+				Label:    track.Label,
+				Format:   model.SubtitleFormatVTT,
+				URL:      fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/episode/%d/subtitles/%s", animeID, episodeID, track.Language),
+			})
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,162 @@
+package imagecache
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurhash encodes the image with the BlurHash algorithm, see
+// https://github.com/woltapp/blurhash/blob/master/Algorithm.md. The image
+// should already be small since every pixel is read for every component.
+func blurhash(img image.Image, xComponents int, yComponents int) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// the linear RGB of every pixel is reused by every component
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			linear[y*width+x] = [3]float64{
+				sRGBToLinear(r >> 8),
+				sRGBToLinear(g >> 8),
+				sRGBToLinear(b >> 8),
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * linear[y*width+x][c]
+					}
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(base83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		var actualMaximum float64
+		for _, factor := range factors[1:] {
+			for _, value := range factor {
+				actualMaximum = math.Max(actualMaximum, math.Abs(value))
+			}
+		}
+
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		sb.WriteString(base83(quantisedMaximum, 1))
+	} else {
+		sb.WriteString(base83(0, 1))
+	}
+
+	dc := factors[0]
+	sb.WriteString(base83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, factor := range factors[1:] {
+		var value int
+		for _, component := range factor {
+			quantised := int(math.Max(0, math.Min(18, math.Floor(signPow(component/maximumValue, 0.5)*9+9.5))))
+			value = value*19 + quantised
+		}
+		sb.WriteString(base83(value, 2))
+	}
+
+	return sb.String()
+}
+
+// dominantColor returns the average color of the most common RGB bucket of
+// the image as #rrggbb.
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b uint32
+	}
+
+	buckets := map[uint32]*bucket{}
+	var best *bucket
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+
+			// 4 bits per channel is enough to group close colors
+			key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+
+			bk.count++
+			bk.r += r
+			bk.g += g
+			bk.b += b
+			if best == nil || bk.count > best.count {
+				best = bk
+			}
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+
+	n := uint32(best.count)
+	return fmt.Sprintf("#%02x%02x%02x", best.r/n, best.g/n, best.b/n)
+}
+
+func base83(value int, length int) string {
+	result := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result[i-1] = base83Chars[digit]
+	}
+
+	return string(result)
+}
+
+func sRGBToLinear(value uint32) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,33 @@
+package imagecache
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBlurhash(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 8), uint8(y * 5), uint8(255 - x*4 - y*2), 255})
+		}
+	}
+
+	// the hashes of the same image by github.com/buckket/go-blurhash and
+	// github.com/bbrks/go-blurhash, which agree with each other
+	tests := []struct {
+		xComponents, yComponents int
+		want                     string
+	}{
+		{3, 4, "TxH2E42xw#m2ajjugLfkfQnna}ju"},
+		{4, 3, "LxH2E42xw#X9m2ajjue?gLfkfQfk"},
+		{1, 1, "00H2E4"},
+	}
+
+	for _, test := range tests {
+		if got := blurhash(img, test.xComponents, test.yComponents); got != test.want {
+			t.Errorf("%dx%d: got %s, want %s", test.xComponents, test.yComponents, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package imagecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"animenya.site/data"
+	"animenya.site/db"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultMaxBytes is the size of the cache unless the IMAGE_CACHE_MAX_BYTES
+	// env is set
+	defaultMaxBytes = 512 << 20
+	// maxImageSize is the maximum size of a single upstream image
+	maxImageSize = 10 << 20
+	// imageTTL is how long an image is served before it is fetched again
+	imageTTL     = time.Hour * 24 * 7
+	fetchTimeout = time.Second * 15
+	blobDir      = "./.db/blob/"
+)
+
+// Image is a cached image, the caller must close File.
+type Image struct {
+	Hash        string
+	ContentType string
+	Size        int64
+	FetchedAt   time.Time
+	File        *os.File
+}
+
+// meta maps an upstream URL to the blob holding its content, stored in the
+// db keyed by the URL hash.
+type meta struct {
+	URL string `json:"url"`
+	// SourceHash is the hash of the original image of a resized variant
+	SourceHash  string    `json:"source_hash,omitempty"`
+	Hash        string    `json:"hash"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+type entry struct {
+	size       int64
+	accessedAt time.Time
+}
+
+// Cache keeps upstream images on disk, content addressed so the same image
+// used by several URLs is stored once. The least recently used blobs are
+// evicted once the cache is over its size limit.
+type Cache struct {
+	DB       db.DBInterface
+	MaxBytes int64
+
+	client  *http.Client
+	flight  flight
+	mu      sync.Mutex
+	entries map[string]*entry
+	size    int64
+	// metas maps the key of every stored meta to its blob hash, and refs the
+	// other way around, so evicting a blob also deletes its metas
+	metas map[string]string
+	refs  map[string]map[string]bool
+}
+
+func New(db db.DBInterface) *Cache {
+	maxBytes, err := strconv.ParseInt(os.Getenv("IMAGE_CACHE_MAX_BYTES"), 10, 64)
+	if err != nil || maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+
+	return &Cache{
+		DB:       db,
+		MaxBytes: maxBytes,
+		client:   &http.Client{Timeout: fetchTimeout},
+		entries:  map[string]*entry{},
+		metas:    map[string]string{},
+		refs:     map[string]map[string]bool{},
+	}
+}
+
+// Load indexes the blobs already on disk, their modification time is the
+// last access since it is touched on every hit. The metas of missing blobs
+// are deleted.
+func (c *Cache) Load() error {
+	if err := os.MkdirAll(blobDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := filepath.WalkDir(blobDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// left over by a fetch interrupted by a restart
+		if strings.HasPrefix(d.Name(), ".fetch-") {
+			return os.Remove(path)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		c.entries[d.Name()] = &entry{size: info.Size(), accessedAt: info.ModTime()}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keys, err := c.DB.List(data.DBImage)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		m, err := c.loadMeta(key)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("imagecache.Load: failed to read meta")
+			continue
+		}
+
+		if m == nil || c.entries[m.Hash] == nil {
+			key := key
+			if err := c.DB.Delete(data.DBImage, &key); err != nil {
+				log.Error().Err(err).Msg("imagecache.Load: failed to delete meta")
+			}
+			continue
+		}
+
+		c.index(key, m.Hash)
+	}
+
+	return nil
+}
+
+// Get returns the image of the URL, fetching it with the Referer of the
+// source when it is not cached or expired. Concurrent fetches of the same URL
+// are made once.
+func (c *Cache) Get(ctx context.Context, imageURL string) (*Image, error) {
+	key := urlKey(imageURL)
+	m, err := c.loadMeta(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if m != nil && time.Since(m.FetchedAt) < imageTTL {
+		if image, err := c.open(m); err == nil {
+			return image, nil
+		}
+	}
+
+	fetched, err := c.flight.do(key, func() (*meta, error) {
+		fetched, err := c.fetch(ctx, imageURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.saveMeta(key, fetched); err != nil {
+			return nil, err
+		}
+
+		return fetched, nil
+	})
+	if err != nil {
+		// an expired image is still better than none
+		if m != nil {
+			if image, _err := c.open(m); _err == nil {
+				log.Warn().Err(err).Msg("imagecache.Get: failed to fetch image, serving expired one")
+				return image, nil
+			}
+		}
+
+		return nil, err
+	}
+
+	return c.open(fetched)
+}
+
+// loadMeta returns the stored meta of the key, nil when there is none.
+func (c *Cache) loadMeta(key string) (*meta, error) {
+	content, err := c.DB.Get(data.DBImage, &key)
+	if err != nil {
+		if err.Error() == "NOT_FOUND" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var m meta
+	if err := json.Unmarshal(*content, &m); err != nil {
+		return nil, err
+	}
+	if m.Hash == "" {
+		return nil, nil
+	}
+
+	return &m, nil
+}
+
+// saveMeta stores the meta and indexes it, the lock keeps an eviction of its
+// blob from running in between.
+func (c *Cache) saveMeta(key string, m *meta) error {
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.DB.Save(data.DBImage, &key, &content); err != nil {
+		return err
+	}
+
+	c.index(key, m.Hash)
+	return nil
+}
+
+// index records the meta key as pointing to the blob, it must be called with
+// the lock held.
+func (c *Cache) index(key string, hash string) {
+	if old, ok := c.metas[key]; ok {
+		delete(c.refs[old], key)
+		if len(c.refs[old]) == 0 {
+			delete(c.refs, old)
+		}
+	}
+
+	c.metas[key] = hash
+	if c.refs[hash] == nil {
+		c.refs[hash] = map[string]bool{}
+	}
+	c.refs[hash][key] = true
+}
+
+func (c *Cache) open(m *meta) (*Image, error) {
+	file, err := os.Open(blobPath(m.Hash))
+	if err != nil {
+		c.forget(m.Hash)
+		return nil, err
+	}
+
+	c.touch(m.Hash)
+	return &Image{
+		Hash:        m.Hash,
+		ContentType: m.ContentType,
+		Size:        m.Size,
+		FetchedAt:   m.FetchedAt,
+		File:        file,
+	}, nil
+}
+
+// fetch stores the upstream image, see store.
+func (c *Cache) fetch(ctx context.Context, imageURL string) (*meta, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("referer", os.Getenv("SOURCE_URL"))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("NOT_FOUND")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("STATUS_CODE_NOT_OK")
+	}
+
+	m, err := c.store(io.LimitReader(resp.Body, maxImageSize+1), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.URL = imageURL
+	return m, nil
+}
+
+// store streams the content into a temporary file while hashing it, then
+// moves it to its blob path. The content type is sniffed, the fallback is
+// used when the content is not recognized.
+func (c *Cache) store(r io.Reader, fallbackContentType string) (*meta, error) {
+	if err := os.MkdirAll(blobDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(blobDir, ".fetch-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	sniff := &sniffer{}
+	size, err := io.Copy(io.MultiWriter(tmp, hash, sniff), r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxImageSize {
+		return nil, fmt.Errorf("IMAGE_TOO_LARGE")
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	contentType := http.DetectContentType(sniff.head)
+	if contentType == "application/octet-stream" && fallbackContentType != "" {
+		contentType = fallbackContentType
+	}
+
+	m := meta{
+		Hash:        hex.EncodeToString(hash.Sum(nil)),
+		ContentType: contentType,
+		Size:        size,
+		FetchedAt:   time.Now(),
+	}
+
+	path := blobPath(m.Hash)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	c.add(m.Hash, size)
+	return &m, nil
+}
+
+func (c *Cache) add(hash string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.entries[hash]; ok {
+		c.size -= old.size
+	}
+	c.entries[hash] = &entry{size: size, accessedAt: time.Now()}
+	c.size += size
+
+	c.evict()
+}
+
+func (c *Cache) touch(hash string) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[hash]; ok {
+		e.accessedAt = now
+	}
+	c.mu.Unlock()
+
+	// keeps the access time across restarts, see Load
+	os.Chtimes(blobPath(hash), now, now)
+}
+
+func (c *Cache) forget(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[hash]; ok {
+		c.size -= e.size
+		delete(c.entries, hash)
+	}
+}
+
+// evict removes the least recently used blobs and their metas until the cache
+// is back under 90% of its size.
+func (c *Cache) evict() {
+	if c.size <= c.MaxBytes {
+		return
+	}
+
+	hashes := make([]string, 0, len(c.entries))
+	for hash := range c.entries {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return c.entries[hashes[i]].accessedAt.Before(c.entries[hashes[j]].accessedAt)
+	})
+
+	target := c.MaxBytes / 10 * 9
+	for _, hash := range hashes {
+		if c.size <= target {
+			break
+		}
+
+		if err := os.Remove(blobPath(hash)); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Msg("imagecache.evict: failed to remove blob")
+			continue
+		}
+
+		c.size -= c.entries[hash].size
+		delete(c.entries, hash)
+
+		for key := range c.refs[hash] {
+			key := key
+			if err := c.DB.Delete(data.DBImage, &key); err != nil {
+				log.Error().Err(err).Msg("imagecache.evict: failed to delete meta")
+			}
+			delete(c.metas, key)
+		}
+		delete(c.refs, hash)
+	}
+}
+
+func urlKey(imageURL string) string {
+	sum := sha256.Sum256([]byte(imageURL))
+	return hex.EncodeToString(sum[:])
+}
+
+func blobPath(hash string) string {
+	return filepath.Join(blobDir, hash[:2], hash)
+}
+
+// sniffer keeps the first bytes written to it for http.DetectContentType.
+type sniffer struct {
+	head []byte
+}
+
+func (s *sniffer) Write(p []byte) (int, error) {
+	if missing := 512 - len(s.head); missing > 0 {
+		if len(p) < missing {
+			missing = len(p)
+		}
+		s.head = append(s.head, p[:missing]...)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,136 @@
+package imagecache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"animenya.site/data"
+	"animenya.site/db"
+)
+
+// newTestCache runs the cache in a temporary directory, the blobs and the db
+// are relative to the working directory.
+func newTestCache(t *testing.T) *Cache {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	c := New(db.New())
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGetCoalescesFetches(t *testing.T) {
+	c := newTestCache(t)
+
+	var hits int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			image, err := c.Get(context.Background(), server.URL)
+			if err != nil {
+				errs <- err
+				return
+			}
+			image.File.Close()
+		}()
+	}
+
+	// lets every caller join the fetch before it completes
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if hits != 1 {
+		t.Errorf("upstream hit %d times, want 1", hits)
+	}
+}
+
+func TestEvictDeletesMetas(t *testing.T) {
+	c := newTestCache(t)
+	c.MaxBytes = 150
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat(r.URL.Path, 50)))
+	}))
+	defer server.Close()
+
+	first, second := server.URL+"/a", server.URL+"/b"
+	for _, imageURL := range []string{first, second} {
+		image, err := c.Get(context.Background(), imageURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		image.File.Close()
+	}
+
+	key := urlKey(first)
+	if _, err := c.DB.Get(data.DBImage, &key); err == nil || err.Error() != "NOT_FOUND" {
+		t.Errorf("meta of the evicted image: got %v, want NOT_FOUND", err)
+	}
+	if _, ok := c.metas[key]; ok {
+		t.Error("evicted meta is still indexed")
+	}
+
+	key = urlKey(second)
+	if _, err := c.DB.Get(data.DBImage, &key); err != nil {
+		t.Errorf("meta of the kept image: %v", err)
+	}
+}
+
+func TestLoadDeletesOrphanMetas(t *testing.T) {
+	c := newTestCache(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	image, err := c.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image.File.Close()
+	if err := os.Remove(blobPath(image.Hash)); err != nil {
+		t.Fatal(err)
+	}
+
+	c = New(c.DB)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	key := urlKey(server.URL)
+	if _, err := c.DB.Get(data.DBImage, &key); err == nil || err.Error() != "NOT_FOUND" {
+		t.Errorf("meta of the missing blob: got %v, want NOT_FOUND", err)
+	}
+}
@@ -0,0 +1,41 @@
+package imagecache
+
+import "sync"
+
+// flight coalesces the concurrent fetches of the same key, the callers
+// arriving while one runs wait for it and share its result.
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	m    *meta
+	err  error
+}
+
+func (f *flight) do(key string, fn func() (*meta, error)) (*meta, error) {
+	f.mu.Lock()
+	if c, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		<-c.done
+		return c.m, c.err
+	}
+
+	if f.calls == nil {
+		f.calls = map[string]*call{}
+	}
+	c := &call{done: make(chan struct{})}
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	c.m, c.err = fn()
+	close(c.done)
+
+	f.mu.Lock()
+	delete(f.calls, key)
+	f.mu.Unlock()
+
+	return c.m, c.err
+}
@@ -0,0 +1,101 @@
+package imagecache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+const (
+	// previewSize is the size of the thumbnail the previews are computed on
+	previewSize = 32
+	// PlaceholderColor is used when the cover has no known dominant color
+	PlaceholderColor = "#2b2b2b"
+)
+
+// Preview is what the clients render while the image is loading.
+type Preview struct {
+	Blurhash string
+	Color    string
+}
+
+// Preview returns the blurhash and the dominant color of the image of the
+// URL, computed on a small thumbnail of it.
+func (c *Cache) Preview(ctx context.Context, imageURL string) (*Preview, error) {
+	original, err := c.Get(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer original.File.Close()
+
+	config, _, err := image.DecodeConfig(original.File)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxSourcePixels {
+		return nil, fmt.Errorf("IMAGE_TOO_LARGE")
+	}
+	if _, err := original.File.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(original.File)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail := resize(src, Options{Width: previewSize, Height: previewSize, Fit: FitContain})
+
+	// covers are portrait, so more components along the height
+	return &Preview{
+		Blurhash: blurhash(thumbnail, 3, 4),
+		Color:    dominantColor(thumbnail),
+	}, nil
+}
+
+// Placeholder returns an image of the size filled with the #rrggbb color and
+// its content type, used when an image is missing or cannot be fetched. It is
+// a PNG unless the format is jpeg or webp.
+func Placeholder(width int, height int, hex string, format Format) ([]byte, string) {
+	fill, ok := parseHexColor(hex)
+	if !ok {
+		fill, _ = parseHexColor(PlaceholderColor)
+	}
+
+	// every pixel of a single color palette is the color, and it compresses
+	// to almost nothing
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{fill})
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatJPEG:
+		jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		return buf.Bytes(), "image/jpeg"
+	case FormatWebP:
+		encodeWebP(&buf, img)
+		return buf.Bytes(), "image/webp"
+	}
+
+	png.Encode(&buf, img)
+	return buf.Bytes(), "image/png"
+}
+
+func parseHexColor(hex string) (color.RGBA, bool) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, false
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, false
+	}
+
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}, true
+}
@@ -0,0 +1,39 @@
+package imagecache
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestPlaceholder(t *testing.T) {
+	tests := []struct {
+		format      Format
+		contentType string
+		decoded     string
+	}{
+		{"", "image/png", "png"},
+		{FormatPNG, "image/png", "png"},
+		{FormatJPEG, "image/jpeg", "jpeg"},
+		{FormatWebP, "image/webp", "webp"},
+	}
+
+	for _, test := range tests {
+		placeholder, contentType := Placeholder(30, 40, "#ff0000", test.format)
+		if contentType != test.contentType {
+			t.Errorf("%q: content type %s, want %s", test.format, contentType, test.contentType)
+		}
+
+		img, decoded, err := image.Decode(bytes.NewReader(placeholder))
+		if err != nil {
+			t.Fatalf("%q: %v", test.format, err)
+		}
+		if decoded != test.decoded || img.Bounds().Dx() != 30 || img.Bounds().Dy() != 40 {
+			t.Errorf("%q: got %s %v", test.format, decoded, img.Bounds())
+		}
+
+		if r, g, b, _ := img.At(15, 20).RGBA(); r>>8 < 0xf0 || g>>8 > 0x10 || b>>8 > 0x10 {
+			t.Errorf("%q: got color %d %d %d, want red", test.format, r>>8, g>>8, b>>8)
+		}
+	}
+}
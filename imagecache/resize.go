@@ -0,0 +1,261 @@
+package imagecache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	// gif covers are decoded and served as jpeg, webp is encoded by
+	// encodeWebP
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxDimension is the largest width or height of a resized image
+	MaxDimension = 2048
+	// maxSourcePixels rejects originals that would take too much memory to
+	// decode
+	maxSourcePixels = 50_000_000
+	jpegQuality     = 85
+)
+
+type Fit string
+
+const (
+	// FitContain scales the image to fit in the box, keeping its ratio
+	FitContain Fit = "contain"
+	// FitCover scales the image to fill the box, cropping the overflow
+	FitCover Fit = "cover"
+	// FitFill stretches the image to the box
+	FitFill Fit = "fill"
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+)
+
+func ParseFit(str string) Fit {
+	switch Fit(strings.ToLower(strings.TrimSpace(str))) {
+	case "", FitContain:
+		return FitContain
+	case FitCover:
+		return FitCover
+	case FitFill:
+		return FitFill
+	}
+
+	return ""
+}
+
+func ParseFormat(str string) Format {
+	switch Format(strings.ToLower(strings.TrimSpace(str))) {
+	case "":
+		return ""
+	case FormatJPEG, "jpg":
+		return FormatJPEG
+	case FormatPNG:
+		return FormatPNG
+	case FormatWebP:
+		return FormatWebP
+	}
+
+	return ""
+}
+
+// Options describes a variant of an image, zero values keep the original.
+type Options struct {
+	Width  int
+	Height int
+	Fit    Fit
+	Format Format
+}
+
+func (o Options) IsEmpty() bool {
+	return o.Width == 0 && o.Height == 0 && o.Format == ""
+}
+
+func (o Options) key() string {
+	return fmt.Sprintf("w=%d&h=%d&fit=%s&format=%s", o.Width, o.Height, o.Fit, o.Format)
+}
+
+// GetVariant returns the image of the URL resized and converted as described
+// by the options. Variants are cached like the originals and made again when
+// the original changes.
+func (c *Cache) GetVariant(ctx context.Context, imageURL string, opts Options) (*Image, error) {
+	original, err := c.Get(ctx, imageURL)
+	if err != nil || opts.IsEmpty() {
+		return original, err
+	}
+	defer original.File.Close()
+
+	format := opts.Format
+	if format == "" {
+		format = formatOf(original.ContentType)
+	}
+
+	key := urlKey(imageURL + "#" + opts.key())
+	m, err := c.loadMeta(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if m != nil && m.SourceHash == original.Hash {
+		if image, err := c.open(m); err == nil {
+			return image, nil
+		}
+	}
+
+	m, err = c.flight.do(key, func() (*meta, error) {
+		var buf bytes.Buffer
+		if err := transform(original.File, &buf, opts, format); err != nil {
+			return nil, err
+		}
+
+		m, err := c.store(&buf, "")
+		if err != nil {
+			return nil, err
+		}
+		m.URL = imageURL
+		m.SourceHash = original.Hash
+
+		if err := c.saveMeta(key, m); err != nil {
+			return nil, err
+		}
+
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.open(m)
+}
+
+// formatOf returns the output format keeping the original one when it can be
+// encoded, jpeg otherwise.
+func formatOf(contentType string) Format {
+	switch contentType {
+	case "image/png":
+		return FormatPNG
+	case "image/webp":
+		return FormatWebP
+	}
+
+	return FormatJPEG
+}
+
+func transform(r io.ReadSeeker, w io.Writer, opts Options, format Format) error {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxSourcePixels {
+		return fmt.Errorf("IMAGE_TOO_LARGE")
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+
+	dst := resize(src, opts)
+	switch format {
+	case FormatPNG:
+		return png.Encode(w, dst)
+	case FormatJPEG:
+		return jpeg.Encode(w, dst, &jpeg.Options{Quality: jpegQuality})
+	case FormatWebP:
+		return encodeWebP(w, dst)
+	}
+
+	return fmt.Errorf("UNSUPPORTED_FORMAT")
+}
+
+// resize scales the image into the box of the options, never upscaling it.
+// A missing width or height is computed from the ratio of the image.
+func resize(src image.Image, opts Options) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if (opts.Width == 0 && opts.Height == 0) || srcW == 0 || srcH == 0 {
+		return src
+	}
+
+	boxW, boxH := opts.Width, opts.Height
+	if boxW == 0 {
+		boxW = srcW * boxH / srcH
+	}
+	if boxH == 0 {
+		boxH = srcH * boxW / srcW
+	}
+	// never upscale, a cover box is scaled down as a whole so the crop keeps
+	// the requested ratio
+	if opts.Fit == FitCover {
+		if boxW > srcW || boxH > srcH {
+			if srcW*boxH < srcH*boxW {
+				boxW, boxH = srcW, boxH*srcW/boxW
+			} else {
+				boxW, boxH = boxW*srcH/boxH, srcH
+			}
+		}
+	} else {
+		if boxW > srcW {
+			boxW = srcW
+		}
+		if boxH > srcH {
+			boxH = srcH
+		}
+	}
+	if boxW < 1 {
+		boxW = 1
+	}
+	if boxH < 1 {
+		boxH = 1
+	}
+
+	crop := bounds
+	dstW, dstH := boxW, boxH
+	switch opts.Fit {
+	case FitCover:
+		// crop the source to the ratio of the box, centered
+		if srcW*boxH > srcH*boxW {
+			w := srcH * boxW / boxH
+			crop = image.Rect(bounds.Min.X+(srcW-w)/2, bounds.Min.Y, bounds.Min.X+(srcW-w)/2+w, bounds.Max.Y)
+		} else {
+			h := srcW * boxH / boxW
+			crop = image.Rect(bounds.Min.X, bounds.Min.Y+(srcH-h)/2, bounds.Max.X, bounds.Min.Y+(srcH-h)/2+h)
+		}
+	case FitFill:
+	default:
+		if srcW*boxH > srcH*boxW {
+			dstH = srcH * boxW / srcW
+		} else {
+			dstW = srcW * boxH / srcH
+		}
+	}
+
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+	return dst
+}
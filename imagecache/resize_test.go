@@ -0,0 +1,93 @@
+package imagecache
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name         string
+		srcW, srcH   int
+		opts         Options
+		wantW, wantH int
+	}{
+		{"contain", 400, 200, Options{Width: 100, Height: 100, Fit: FitContain}, 100, 50},
+		{"contain never upscales", 200, 400, Options{Width: 300, Height: 300, Fit: FitContain}, 150, 300},
+		{"cover", 400, 200, Options{Width: 100, Height: 100, Fit: FitCover}, 100, 100},
+		{"cover keeps the box ratio", 200, 400, Options{Width: 300, Height: 300, Fit: FitCover}, 200, 200},
+		{"cover over both sides", 200, 400, Options{Width: 600, Height: 300, Fit: FitCover}, 200, 100},
+		{"fill", 400, 200, Options{Width: 100, Height: 100, Fit: FitFill}, 100, 100},
+		{"fill never upscales", 200, 400, Options{Width: 300, Height: 300, Fit: FitFill}, 200, 300},
+		{"width only", 400, 200, Options{Width: 100, Fit: FitContain}, 100, 50},
+		{"height only", 400, 200, Options{Height: 100, Fit: FitCover}, 200, 100},
+		{"nothing to do", 400, 200, Options{Fit: FitContain}, 400, 200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, test.srcW, test.srcH))
+			got := resize(src, test.opts).Bounds()
+			if got.Dx() != test.wantW || got.Dy() != test.wantH {
+				t.Errorf("got %dx%d, want %dx%d", got.Dx(), got.Dy(), test.wantW, test.wantH)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{
+		"":      "",
+		"jpeg":  FormatJPEG,
+		"JPG":   FormatJPEG,
+		" png ": FormatPNG,
+		"WebP":  FormatWebP,
+		"gif":   "",
+	}
+
+	for str, want := range tests {
+		if got := ParseFormat(str); got != want {
+			t.Errorf("ParseFormat(%q) = %q, want %q", str, got, want)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]Format{
+		"image/png":  FormatPNG,
+		"image/jpeg": FormatJPEG,
+		"image/webp": FormatWebP,
+		"image/gif":  FormatJPEG,
+	}
+
+	for contentType, want := range tests {
+		if got := formatOf(contentType); got != want {
+			t.Errorf("formatOf(%q) = %q, want %q", contentType, got, want)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []Format{FormatJPEG, FormatPNG, FormatWebP} {
+		var dst bytes.Buffer
+		opts := Options{Width: 10, Fit: FitContain, Format: format}
+		if err := transform(bytes.NewReader(src.Bytes()), &dst, opts, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		config, got, err := image.DecodeConfig(&dst)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got != string(format) || config.Width != 10 || config.Height != 5 {
+			t.Errorf("got %s %dx%d, want %s 10x5", got, config.Width, config.Height, format)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package imagecache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+// The x/image package only decodes WebP, covers are encoded here as lossless
+// WebP (VP8L). The pixels go through the subtract green and predictor
+// transforms and are entropy coded without backward references nor color
+// cache, which keeps the encoder small.
+
+const (
+	webpMaxDimension = 1 << 14
+	// webpTileBits is the log-2 size of the predictor tiles
+	webpTileBits = 5
+	// webpMaxCodeLength is the longest prefix code allowed by the format, and
+	// webpMaxCodeLengthCodeLength the longest one coding the code lengths
+	webpMaxCodeLength           = 15
+	webpMaxCodeLengthCodeLength = 7
+	// webpGreenAlphabetSize counts the length prefix codes after the 256
+	// green literals, the other alphabets are webpAlphabetSize long
+	webpGreenAlphabetSize    = 256 + 24
+	webpAlphabetSize         = 256
+	webpDistanceAlphabetSize = 40
+
+	webpTransformPredictor     = 0
+	webpTransformSubtractGreen = 2
+
+	webpPredictorLeft    = 1
+	webpPredictorTop     = 2
+	webpPredictorAverage = 7
+	webpPredictorSelect  = 11
+)
+
+// webpCodeLengthOrder is the order in which the lengths of the code length
+// code are written.
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// webpPredictors are the predictor modes tried for every tile.
+var webpPredictors = []int{webpPredictorLeft, webpPredictorTop, webpPredictorAverage, webpPredictorSelect}
+
+// encodeWebP writes the image as a lossless WebP.
+func encodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > webpMaxDimension || height > webpMaxDimension {
+		return fmt.Errorf("INVALID_IMAGE_SIZE")
+	}
+
+	// VP8L stores non premultiplied colors, as NRGBA does
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Stride != 4*width {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+	pix := make([]uint8, len(nrgba.Pix))
+	copy(pix, nrgba.Pix)
+
+	alpha := false
+	for p := 3; p < len(pix); p += 4 {
+		if pix[p] != 0xff {
+			alpha = true
+			break
+		}
+	}
+
+	var bw webpBitWriter
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.writeBool(alpha)
+	bw.write(0, 3)
+
+	bw.writeBool(true)
+	bw.write(webpTransformSubtractGreen, 2)
+	for p := 0; p < len(pix); p += 4 {
+		pix[p+0] -= pix[p+1]
+		pix[p+2] -= pix[p+1]
+	}
+
+	bw.writeBool(true)
+	bw.write(webpTransformPredictor, 2)
+	bw.write(webpTileBits-2, 3)
+	modes, tiles := webpPredict(pix, width, height)
+	writeWebPImage(&bw, tiles, false)
+
+	bw.writeBool(false)
+	writeWebPImage(&bw, modes, true)
+
+	data := bw.bytes()
+	padding := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding != 0 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+
+	return nil
+}
+
+// webpPredict returns the residuals of the pixels, predicted with the mode of
+// their tile, and the tile image holding the modes in its green channel.
+func webpPredict(pix []uint8, width int, height int) ([]uint8, []uint8) {
+	tileSize := 1 << webpTileBits
+	tilesX := (width + tileSize - 1) >> webpTileBits
+	tilesY := (height + tileSize - 1) >> webpTileBits
+
+	tiles := make([]uint8, 4*tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := webpPredictorLeft, -1
+			for _, mode := range webpPredictors {
+				cost := 0
+				for y := ty * tileSize; y < height && y < (ty+1)*tileSize; y++ {
+					for x := tx * tileSize; x < width && x < (tx+1)*tileSize; x++ {
+						prediction := webpPrediction(pix, width, x, y, mode)
+						for c := 0; c < 4; c++ {
+							residual := int(int8(pix[4*(y*width+x)+c] - prediction[c]))
+							if residual < 0 {
+								residual = -residual
+							}
+							cost += residual
+						}
+					}
+				}
+
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			tiles[4*(ty*tilesX+tx)+1] = uint8(best)
+		}
+	}
+
+	residuals := make([]uint8, len(pix))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := int(tiles[4*((y>>webpTileBits)*tilesX+(x>>webpTileBits))+1])
+			prediction := webpPrediction(pix, width, x, y, mode)
+			for c := 0; c < 4; c++ {
+				residuals[4*(y*width+x)+c] = pix[4*(y*width+x)+c] - prediction[c]
+			}
+		}
+	}
+
+	return residuals, tiles
+}
+
+// webpPrediction returns the prediction of the pixel, the first pixel is
+// predicted as opaque black, the rest of the first row from the left and the
+// first column from the top, whatever the mode of their tile.
+func webpPrediction(pix []uint8, width int, x int, y int, mode int) [4]uint8 {
+	p := 4 * (y*width + x)
+	switch {
+	case x == 0 && y == 0:
+		return [4]uint8{0, 0, 0, 0xff}
+	case y == 0:
+		mode = webpPredictorLeft
+	case x == 0:
+		mode = webpPredictorTop
+	}
+
+	var prediction [4]uint8
+	left, top, topLeft := p-4, p-4*width, p-4*width-4
+	switch mode {
+	case webpPredictorLeft:
+		copy(prediction[:], pix[left:left+4])
+	case webpPredictorTop:
+		copy(prediction[:], pix[top:top+4])
+	case webpPredictorAverage:
+		for c := 0; c < 4; c++ {
+			prediction[c] = uint8((int(pix[left+c]) + int(pix[top+c])) / 2)
+		}
+	case webpPredictorSelect:
+		// the neighbor closest to the gradient left + top - top left
+		toLeft, toTop := 0, 0
+		for c := 0; c < 4; c++ {
+			toLeft += webpAbs(int(pix[topLeft+c]) - int(pix[top+c]))
+			toTop += webpAbs(int(pix[topLeft+c]) - int(pix[left+c]))
+		}
+		if toLeft < toTop {
+			copy(prediction[:], pix[left:left+4])
+		} else {
+			copy(prediction[:], pix[top:top+4])
+		}
+	}
+
+	return prediction
+}
+
+func webpAbs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// writeWebPImage entropy codes the RGBA pixels with a single group of prefix
+// codes, the meta prefix codes flag is only written for the main image.
+func writeWebPImage(bw *webpBitWriter, pix []uint8, main bool) {
+	// no color cache
+	bw.writeBool(false)
+	if main {
+		bw.writeBool(false)
+	}
+
+	green := make([]uint32, webpGreenAlphabetSize)
+	red := make([]uint32, webpAlphabetSize)
+	blue := make([]uint32, webpAlphabetSize)
+	alpha := make([]uint32, webpAlphabetSize)
+	for p := 0; p < len(pix); p += 4 {
+		red[pix[p+0]]++
+		green[pix[p+1]]++
+		blue[pix[p+2]]++
+		alpha[pix[p+3]]++
+	}
+
+	codes := [4]*webpPrefixCode{}
+	for i, counts := range [][]uint32{green, red, blue, alpha} {
+		codes[i] = newWebPPrefixCode(counts, webpMaxCodeLength)
+		codes[i].writeTo(bw)
+	}
+	// no backward reference, so no distance either
+	newWebPPrefixCode(make([]uint32, webpDistanceAlphabetSize), webpMaxCodeLength).writeTo(bw)
+
+	for p := 0; p < len(pix); p += 4 {
+		codes[0].writeSymbol(bw, int(pix[p+1]))
+		codes[1].writeSymbol(bw, int(pix[p+0]))
+		codes[2].writeSymbol(bw, int(pix[p+2]))
+		codes[3].writeSymbol(bw, int(pix[p+3]))
+	}
+}
+
+// webpPrefixCode is a canonical prefix code of an alphabet, a code of at most
+// two symbols below 256 is written as a simple code.
+type webpPrefixCode struct {
+	lengths []uint8
+	// codes are bit reversed, the decoder reads the first bit of a code as
+	// the lowest one
+	codes   []uint32
+	symbols []int
+}
+
+func newWebPPrefixCode(counts []uint32, maxLength int) *webpPrefixCode {
+	code := &webpPrefixCode{lengths: make([]uint8, len(counts)), codes: make([]uint32, len(counts))}
+	for symbol, count := range counts {
+		if count > 0 {
+			code.symbols = append(code.symbols, symbol)
+		}
+	}
+
+	switch len(code.symbols) {
+	case 0:
+		// an unused alphabet still needs a code, a single symbol takes no bit
+		code.symbols = []int{0}
+		return code
+	case 1:
+		return code
+	}
+
+	code.lengths = webpCodeLengths(counts, maxLength)
+	code.setCodes()
+	return code
+}
+
+// setCodes assigns the canonical codes of the lengths.
+func (pc *webpPrefixCode) setCodes() {
+	var histogram [webpMaxCodeLength + 1]uint32
+	for _, length := range pc.lengths {
+		histogram[length]++
+	}
+	histogram[0] = 0
+
+	var next [webpMaxCodeLength + 1]uint32
+	code := uint32(0)
+	for length := 1; length <= webpMaxCodeLength; length++ {
+		code = (code + histogram[length-1]) << 1
+		next[length] = code
+	}
+
+	for symbol, length := range pc.lengths {
+		if length == 0 {
+			continue
+		}
+
+		reversed := uint32(0)
+		for i := uint8(0); i < length; i++ {
+			reversed |= (next[length] >> i & 1) << (length - 1 - i)
+		}
+		pc.codes[symbol] = reversed
+		next[length]++
+	}
+}
+
+func (pc *webpPrefixCode) isSimple() bool {
+	return len(pc.symbols) <= 2 && pc.symbols[len(pc.symbols)-1] < 256
+}
+
+func (pc *webpPrefixCode) writeSymbol(bw *webpBitWriter, symbol int) {
+	switch {
+	case len(pc.symbols) == 1:
+	case pc.isSimple():
+		if symbol == pc.symbols[0] {
+			bw.write(0, 1)
+		} else {
+			bw.write(1, 1)
+		}
+	default:
+		bw.write(pc.codes[symbol], uint(pc.lengths[symbol]))
+	}
+}
+
+func (pc *webpPrefixCode) writeTo(bw *webpBitWriter) {
+	if pc.isSimple() {
+		bw.writeBool(true)
+		bw.write(uint32(len(pc.symbols)-1), 1)
+		if pc.symbols[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(pc.symbols[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(pc.symbols[0]), 8)
+		}
+		if len(pc.symbols) == 2 {
+			bw.write(uint32(pc.symbols[1]), 8)
+		}
+		return
+	}
+
+	bw.writeBool(false)
+
+	// the lengths are written with a prefix code of their own, 16 repeats
+	// the previous length 3 to 6 times, 17 and 18 repeat zero 3 to 10 and 11
+	// to 138 times
+	type token struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+	var tokens []token
+	for i := 0; i < len(pc.lengths); {
+		length := pc.lengths[i]
+		run := 1
+		for i+run < len(pc.lengths) && pc.lengths[i+run] == length {
+			run++
+		}
+		i += run
+
+		if length == 0 {
+			for run >= 11 {
+				n := run
+				if n > 138 {
+					n = 138
+				}
+				tokens = append(tokens, token{18, uint32(n - 11), 7})
+				run -= n
+			}
+			if run >= 3 {
+				tokens = append(tokens, token{17, uint32(run - 3), 3})
+				run = 0
+			}
+			for ; run > 0; run-- {
+				tokens = append(tokens, token{symbol: 0})
+			}
+			continue
+		}
+
+		tokens = append(tokens, token{symbol: int(length)})
+		run--
+		for run >= 3 {
+			n := run
+			if n > 6 {
+				n = 6
+			}
+			tokens = append(tokens, token{16, uint32(n - 3), 2})
+			run -= n
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, token{symbol: int(length)})
+		}
+	}
+
+	counts := make([]uint32, len(webpCodeLengthOrder))
+	for _, t := range tokens {
+		counts[t.symbol]++
+	}
+	lengthCode := newWebPPrefixCode(counts, webpMaxCodeLengthCodeLength)
+	// a single symbol has no bit but still needs a length, see writeSymbol
+	if len(lengthCode.symbols) == 1 {
+		lengthCode.lengths[lengthCode.symbols[0]] = 1
+	}
+
+	n := len(webpCodeLengthOrder)
+	for n > 4 && lengthCode.lengths[webpCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(uint32(n-4), 4)
+	for _, symbol := range webpCodeLengthOrder[:n] {
+		bw.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+
+	// every length is written, without a max symbol
+	bw.writeBool(false)
+	for _, t := range tokens {
+		if len(lengthCode.symbols) > 1 {
+			bw.write(lengthCode.codes[t.symbol], uint(lengthCode.lengths[t.symbol]))
+		}
+		if t.extraBits > 0 {
+			bw.write(t.extra, t.extraBits)
+		}
+	}
+}
+
+// webpCodeLengths returns the Huffman code lengths of the counts, at least two
+// of them not zero, limited to maxLength by flattening the counts until the
+// tree is shallow enough.
+func webpCodeLengths(counts []uint32, maxLength int) []uint8 {
+	weights := make([]uint32, len(counts))
+	copy(weights, counts)
+
+	for {
+		lengths := webpHuffmanLengths(weights)
+		deepest := uint8(0)
+		for _, length := range lengths {
+			if length > deepest {
+				deepest = length
+			}
+		}
+		if int(deepest) <= maxLength {
+			return lengths
+		}
+
+		for i, weight := range weights {
+			if weight > 0 {
+				weights[i] = (weight + 1) / 2
+			}
+		}
+	}
+}
+
+// webpHuffmanLengths builds the Huffman tree of the weights with two queues,
+// the sorted leaves and the internal nodes in the order they are made.
+func webpHuffmanLengths(weights []uint32) []uint8 {
+	type node struct {
+		weight uint64
+		parent int
+	}
+
+	var nodes []node
+	var leaves []int
+	symbols := map[int]int{}
+	for symbol, weight := range weights {
+		if weight > 0 {
+			symbols[len(nodes)] = symbol
+			leaves = append(leaves, len(nodes))
+			nodes = append(nodes, node{weight: uint64(weight), parent: -1})
+		}
+	}
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return nodes[leaves[i]].weight < nodes[leaves[j]].weight
+	})
+
+	var internal []int
+	pop := func() int {
+		if len(internal) == 0 || (len(leaves) > 0 && nodes[leaves[0]].weight <= nodes[internal[0]].weight) {
+			n := leaves[0]
+			leaves = leaves[1:]
+			return n
+		}
+
+		n := internal[0]
+		internal = internal[1:]
+		return n
+	}
+
+	for len(leaves)+len(internal) > 1 {
+		a, b := pop(), pop()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, parent: -1})
+		nodes[a].parent = len(nodes) - 1
+		nodes[b].parent = len(nodes) - 1
+		internal = append(internal, len(nodes)-1)
+	}
+
+	lengths := make([]uint8, len(weights))
+	for n, symbol := range symbols {
+		depth := uint8(0)
+		for p := nodes[n].parent; p >= 0; p = nodes[p].parent {
+			depth++
+		}
+		lengths[symbol] = depth
+	}
+
+	return lengths
+}
+
+// webpBitWriter writes the bits from the lowest one of every byte.
+type webpBitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (bw *webpBitWriter) write(bits uint32, n uint) {
+	bw.acc |= uint64(bits) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+func (bw *webpBitWriter) writeBool(b bool) {
+	if b {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+}
+
+// bytes flushes the last bits, padded with zeros.
+func (bw *webpBitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nbits = 0, 0
+	}
+
+	return bw.buf
+}
@@ -0,0 +1,101 @@
+package imagecache
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	fill := func(width int, height int, at func(x, y int) color.NRGBA) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.SetNRGBA(x, y, at(x, y))
+			}
+		}
+		return img
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"single pixel", fill(1, 1, func(x, y int) color.NRGBA { return color.NRGBA{200, 100, 50, 255} })},
+		{"single color", fill(64, 96, func(x, y int) color.NRGBA { return color.NRGBA{0x1f, 0x29, 0x37, 255} })},
+		{"two colors", fill(33, 17, func(x, y int) color.NRGBA {
+			if (x+y)%2 == 0 {
+				return color.NRGBA{255, 255, 255, 255}
+			}
+			return color.NRGBA{0, 0, 0, 255}
+		})},
+		{"gradient over several tiles", fill(150, 70, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x), uint8(y * 3), uint8(x + y), 255}
+		})},
+		{"noise with alpha", fill(71, 45, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256))}
+		})},
+		{"a single row", fill(300, 1, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), 0, uint8(255 - x), 255} })},
+		{"a single column", fill(1, 300, func(x, y int) color.NRGBA { return color.NRGBA{0, uint8(y), 0, 128} })},
+		{"other image types are converted", image.NewGray(image.Rect(0, 0, 10, 10))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, test.img); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Bounds() != test.img.Bounds() {
+				t.Fatalf("bounds %v, want %v", got.Bounds(), test.img.Bounds())
+			}
+
+			bounds := test.img.Bounds()
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					want := color.NRGBAModel.Convert(test.img.At(x, y))
+					if got := color.NRGBAModel.Convert(got.At(x, y)); got != want {
+						t.Fatalf("pixel %d,%d: got %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+
+	if err := encodeWebP(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, webpMaxDimension+1, 1))); err == nil {
+		t.Error("encoded an image wider than the format allows")
+	}
+}
+
+func TestWebPCodeLengths(t *testing.T) {
+	// fibonacci counts make the deepest Huffman tree
+	counts := make([]uint32, 30)
+	a, b := uint32(1), uint32(1)
+	for i := range counts {
+		counts[i] = a
+		a, b = b, a+b
+	}
+
+	lengths := webpCodeLengths(counts, webpMaxCodeLength)
+	kraft := 0.0
+	for _, length := range lengths {
+		if length == 0 || length > webpMaxCodeLength {
+			t.Fatalf("length %d out of 1..%d", length, webpMaxCodeLength)
+		}
+		kraft += 1 / float64(uint(1)<<length)
+	}
+	// a complete code, which the decoders require
+	if kraft != 1 {
+		t.Errorf("kraft sum %v, want 1", kraft)
+	}
+}
@@ -5,15 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"animenya.site/db"
 	"animenya.site/model"
 	"github.com/rs/zerolog/log"
 )
@@ -24,9 +25,10 @@ type FetcherInterface interface {
 	GetAllEpisodesByAnimeID(ctx context.Context, animeID string) ([]*model.Episode, error) // deprecated: use GetAnimeDetailByPostID instead
 	GetAnimeDetailByAnimeSlug(ctx context.Context, animeSlug *string) (*model.Anime, error)
 	GetAnimeDetailByPostID(ctx context.Context, postID *int) (*model.Anime, error)
-	GetAnimeBySearch(ctc context.Context, db db.DBInterface, query *string) ([]*model.SimpleAnime, error)
+	GetAnimeBySearch(ctx context.Context, query *string) ([]*model.Anime, error)
 	// GetAnimePostIDByAnimeSlug(ctx context.Context, animeSlug *string) (*int, error)
-	GetEpisodeWatchesByEpisodeIDAndEpisodeSlug(ctx context.Context, episodeID *int, episodeSlug *string) ([]*model.Watch, error)
+	GetEpisodeWatchesByEpisodeIDAndEpisodeSlug(ctx context.Context, episodeID *int, episodeSlug *string) ([]*model.Watch, error) // deprecated: use GetEpisodeByEpisodeIDAndEpisodeSlug instead
+	GetEpisodeByEpisodeIDAndEpisodeSlug(ctx context.Context, episodeID *int, episodeSlug *string) (*model.Episode, error)
 }
 
 func NewFetcher() *Fetcher {
@@ -49,9 +51,10 @@ func (f *Fetcher) getAnimeEpisode(ctx context.Context, endpoint *string) ([]*mod
 	var categoriesID []string
 	var result []*model.Episode
 	for _, item := range resp {
-		var coverURL string
+		// the post image is a screenshot of the episode, not the anime cover
+		var thumbnailURL string
 		if len(item.Yoast_Head_Json.Og_Image) > 0 {
-			coverURL = item.Yoast_Head_Json.Og_Image[0].URL
+			thumbnailURL = item.Yoast_Head_Json.Og_Image[0].URL
 		}
 
 		var categoryID int
@@ -59,28 +62,17 @@ func (f *Fetcher) getAnimeEpisode(ctx context.Context, endpoint *string) ([]*mod
 			categoryID = item.Categories[0]
 		}
 
-		title, err := MatchStringByRegex(`(.*?)(?:\s+Epsiode|Episode)`, item.Title.Rendered)
-		if err != nil {
-			log.Error().Err(err).Msg("fetcher.getAnimeEpisode: failed to parse title")
-			return nil, err
-		}
-
-		episode, err := MatchStringByRegex(`(?:Episode.|Epsiode.)(.*)`, item.Title.Rendered)
-		if err != nil {
-			log.Error().Err(err).Msg("fetcher.getAnimeEpisode: failed to parse episode")
-			return nil, err
-		}
-		// probably this is a movie: title-movie
-		if episode == nil {
-			fmt.Println(item.Title)
-			continue
-		}
+		var episode model.Episode
+		title := episode.ParseEpisodeTitle(item.Title.Rendered)
 
-		slug, err := MatchStringByRegex(`(.*)-(?:episode.|epsiode.*)`, item.Slug)
+		slug, err := MatchStringByRegex(`(.*?)-(?:episode|epsiode|movie|film|ova|oad|ona|special|sp|batch)(?:-|$)`, item.Slug)
 		if err != nil {
 			log.Error().Err(err).Msg("fetcher.getAnimeEpisode: failed to parse slug")
 			return nil, err
 		}
+		if slug == nil {
+			slug = &item.Slug
+		}
 
 		date, err := time.Parse("2006-01-02T15:04:05", item.Date)
 		if err != nil {
@@ -91,18 +83,16 @@ func (f *Fetcher) getAnimeEpisode(ctx context.Context, endpoint *string) ([]*mod
 		strCategoryID := strconv.Itoa(categoryID)
 		categoriesID = append(categoriesID, strCategoryID)
 
-		result = append(result, &model.Episode{
-			ID:      item.ID,
-			Episode: *episode,
-			Slug:    item.Slug,
-			Anime: &model.Anime{
-				ID:       categoryID,
-				Title:    *title,
-				Slug:     *slug,
-				CoverURL: coverURL,
-			},
-			CreatedAt: &date,
-		})
+		episode.ID = item.ID
+		episode.Slug = item.Slug
+		episode.ThumbnailURL = thumbnailURL
+		episode.Anime = &model.Anime{
+			ID:    categoryID,
+			Title: strings.TrimSpace(title),
+			Slug:  *slug,
+		}
+		episode.CreatedAt = &date
+		result = append(result, &episode)
 	}
 
 	if len(categoriesID) > 0 {
@@ -225,7 +215,32 @@ func (f *Fetcher) GetAnimeDetailByAnimeSlug(ctx context.Context, animeSlug *stri
 		log.Error().Err(err).Msg("fetcher.GetAnimeDetailByAnimeSlug: failed to parse total episode")
 	}
 	if totalEpisode != nil {
-		anime.TotalEpisode = totalEpisode
+		anime.TotalEpisodeRaw = totalEpisode
+	}
+
+	for _, label := range []string{"Japanese", "English", "Synonyms"} {
+		alternativeTitle, err := MatchStringByRegex(`<b>`+label+`</b>\s*(?:<[^>]*>)*([^<]*)<`, *body)
+		if err != nil {
+			log.Error().Err(err).Msg("fetcher.GetAnimeDetailByAnimeSlug: failed to parse alternative title")
+			continue
+		}
+		if alternativeTitle == nil {
+			continue
+		}
+
+		for _, title := range strings.Split(*alternativeTitle, ",") {
+			if title = strings.TrimSpace(title); title != "" && title != "-" {
+				anime.AlternativeTitles = append(anime.AlternativeTitles, title)
+			}
+		}
+	}
+
+	animeType, err := MatchStringByRegex(`<b>Type</b>\s*(?:<[^>]*>)*([^<]*)<`, *body)
+	if err != nil {
+		log.Error().Err(err).Msg("fetcher.GetAnimeDetailByAnimeSlug: failed to parse type")
+	}
+	if animeType != nil {
+		anime.Type = model.ParseAnimeType(*animeType)
 	}
 
 	studio, err := MatchStringByRegex(`Studio.*"tag".(.*)</a`, *body)
@@ -236,13 +251,14 @@ func (f *Fetcher) GetAnimeDetailByAnimeSlug(ctx context.Context, animeSlug *stri
 		anime.Studio = studio
 	}
 
-	// season, err := MatchStringByRegex(`Season..*season.*">(.*)</a></span>.*<span><b>Studio</b>`, *body)
-	// if err != nil {
-	// 	log.Error().Err(err).Msg("fetcher.GetAnimeDetailByAnimeSlug: failed to parse season")
-	// }
-	// if season != nil {
-	// 	anime.Season = season
-	// }
+	season, err := MatchStringByRegex(`<b>Season</b>\s*<a[^>]*>([^<]*)</a>`, *body)
+	if err != nil {
+		log.Error().Err(err).Msg("fetcher.GetAnimeDetailByAnimeSlug: failed to parse season")
+	}
+	if season != nil && strings.TrimSpace(*season) != "" {
+		*season = strings.TrimSpace(*season)
+		anime.Season = season
+	}
 
 	// releaseDate, err := MatchStringByRegex(`Rilis:.*b>(.*)</span`, *body)
 	// if err != nil {
@@ -252,6 +268,7 @@ func (f *Fetcher) GetAnimeDetailByAnimeSlug(ctx context.Context, animeSlug *stri
 	// 	anime.ReleaseDate = releaseDate
 	// }
 
+	anime.Normalize()
 	return &anime, nil
 }
 
@@ -275,11 +292,11 @@ func (f *Fetcher) GetAnimeDetailByPostID(ctx context.Context, postID *int) (*mod
 	var anime model.Anime
 	anime.Title = animeRaw.Title
 	anime.CoverURL = animeRaw.Cover
-	anime.Duration = &animeRaw.Duration
+	anime.DurationRaw = &animeRaw.Duration
 	anime.Synopsis = &animeRaw.Synopsis
-	anime.ReleaseDate = &animeRaw.Released
-	anime.Status = &animeRaw.Status
-	anime.Score = &animeRaw.Score
+	anime.ReleaseDateRaw = &animeRaw.Released
+	anime.StatusRaw = &animeRaw.Status
+	anime.ScoreRaw = &animeRaw.Score
 
 	for _, _genre := range animeRaw.Genre {
 		var genre model.Genre
@@ -299,9 +316,16 @@ func (f *Fetcher) GetAnimeDetailByPostID(ctx context.Context, postID *int) (*mod
 		*anime.Genre = append(*anime.Genre, genre)
 	}
 
+	for _, season := range animeRaw.Season {
+		if name := strings.TrimSpace(season.Name); name != "" {
+			anime.Season = &name
+			break
+		}
+	}
+
 	for _, episodeRaw := range animeRaw.Data {
 		var episode model.Episode
-		episode.Episode = episodeRaw.Episode
+		episode.ParseEpisode(episodeRaw.Episode)
 
 		_id, err := MatchStringByRegex(`&id=(.*)`, episodeRaw.URL)
 		if err != nil {
@@ -321,7 +345,6 @@ func (f *Fetcher) GetAnimeDetailByPostID(ctx context.Context, postID *int) (*mod
 		episode.ID = id
 
 		for i, player := range episodeRaw.Player {
-			var watch model.Watch
 			streamURL, err := MatchStringByRegex(`src.+"(.*)".F`, player.URL)
 
 			if err != nil {
@@ -333,19 +356,23 @@ func (f *Fetcher) GetAnimeDetailByPostID(ctx context.Context, postID *int) (*mod
 				continue
 			}
 
-			watch.ID = i + 1
-			watch.Source = player.Title
-			watch.StreamURL = *streamURL
-			episode.Watches = append(episode.Watches, &watch)
+			episode.Watches = append(episode.Watches, model.NewWatch(i+1, player.Title, *streamURL))
+		}
+		if episode.Watches != nil {
+			fetchedAt := time.Now()
+			episode.WatchesFetchedAt = &fetchedAt
 		}
 
 		anime.Episodes = append(anime.Episodes, &episode)
 	}
 
+	anime.Normalize()
 	return &anime, nil
 }
 
-func (f *Fetcher) GetEpisodeWatchesByEpisodeIDAndEpisodeSlug(ctx context.Context, episodeID *int, episodeSlug *string) ([]*model.Watch, error) {
+// GetEpisodeByEpisodeIDAndEpisodeSlug returns the watches and the download
+// links of the episode page.
+func (f *Fetcher) GetEpisodeByEpisodeIDAndEpisodeSlug(ctx context.Context, episodeID *int, episodeSlug *string) (*model.Episode, error) {
 	if episodeSlug == nil {
 		return nil, fmt.Errorf("EPISODE_SLUG_NOT_FOUND")
 	}
@@ -360,16 +387,24 @@ func (f *Fetcher) GetEpisodeWatchesByEpisodeIDAndEpisodeSlug(ctx context.Context
 		return nil, err
 	}
 
+	episode := model.Episode{ID: *episodeID, Slug: *episodeSlug}
+	episode.Downloads = parseDownloads(*body)
+
 	_watch, err := MatchAllStringByRegex(`data-nume=".*<span>(.*)</span`, *body)
 	if err != nil {
-		log.Error().Err(err).Msg("fetcher.GetEpisodeWatchesByEpisodeIDAndEpisodeSlug: failed to parse watch")
+		log.Error().Err(err).Msg("fetcher.GetEpisodeByEpisodeIDAndEpisodeSlug: failed to parse watch")
 		return nil, err
 	}
+
+	// a page without any player, e.g. a batch, only has downloads
+	fetchedAt := time.Now()
+	episode.WatchesFetchedAt = &fetchedAt
+	episode.DownloadsFetchedAt = &fetchedAt
 	if _watch == nil {
-		return nil, fmt.Errorf("WATCH_NOT_FOUND")
+		episode.Watches = []*model.Watch{}
+		return &episode, nil
 	}
 
-	var watches []*model.Watch
 	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
 	for i, w := range *_watch {
 		param := url.Values{}
@@ -380,41 +415,109 @@ func (f *Fetcher) GetEpisodeWatchesByEpisodeIDAndEpisodeSlug(ctx context.Context
 		playload := bytes.NewBufferString(param.Encode())
 		body, err = f.Do(ctx, fmt.Sprintf("%s/wp-admin/admin-ajax.php", os.Getenv("SOURCE_URL")), http.MethodPost, nil, playload, &headers)
 		if err != nil {
-			log.Error().Err(err).Msg("fetcher.GetEpisodeWatchesByEpisodeIDAndEpisodeSlug: failed to fetch watch")
+			log.Error().Err(err).Msg("fetcher.GetEpisodeByEpisodeIDAndEpisodeSlug: failed to fetch watch")
 			continue
 		}
 
 		if body == nil {
-			log.Error().Err(err).Msg("fetcher.GetEpisodeWatchesByEpisodeIDAndEpisodeSlug: failed to fetch watch")
+			log.Error().Err(err).Msg("fetcher.GetEpisodeByEpisodeIDAndEpisodeSlug: failed to fetch watch")
 			continue
 		}
 
 		streamURL, err := MatchStringByRegex(`src="(.*)".F`, *body)
 		if err != nil {
-			log.Error().Err(err).Msg("fetcher.GetEpisodeWatchesByEpisodeIDAndEpisodeSlug: failed to parse streamURL")
+			log.Error().Err(err).Msg("fetcher.GetEpisodeByEpisodeIDAndEpisodeSlug: failed to parse streamURL")
 			continue
 		}
 		if streamURL == nil {
-			log.Error().Err(err).Msg("fetcher.GetEpisodeWatchesByEpisodeIDAndEpisodeSlug: failed to parse streamURL")
+			log.Error().Err(err).Msg("fetcher.GetEpisodeByEpisodeIDAndEpisodeSlug: failed to parse streamURL")
 			continue
 		}
 
-		watches = append(watches, &model.Watch{
-			ID:        i + 1,
-			Source:    w,
-			StreamURL: *streamURL,
-		})
+		episode.Watches = append(episode.Watches, model.NewWatch(i+1, w, *streamURL))
 	}
 
-	if len(watches) == 0 {
+	// every player failed to load, which is worth retrying
+	if len(episode.Watches) == 0 {
 		return nil, fmt.Errorf("NO_WATCH_FOUND")
 	}
 
-	return watches, nil
+	return &episode, nil
+}
+
+// deprecated: use GetEpisodeByEpisodeIDAndEpisodeSlug instead
+func (f *Fetcher) GetEpisodeWatchesByEpisodeIDAndEpisodeSlug(ctx context.Context, episodeID *int, episodeSlug *string) ([]*model.Watch, error) {
+	episode, err := f.GetEpisodeByEpisodeIDAndEpisodeSlug(ctx, episodeID, episodeSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	return episode.Watches, nil
+}
+
+var (
+	// a section ends with its list, the items may hold nested divs
+	downloadSectionRegex = regexp.MustCompile(`(?s)<div class="download-eps">(.*?)</ul>\s*</div>`)
+	downloadFormatRegex  = regexp.MustCompile(`(?s)<b>(.*?)</b>`)
+	downloadItemRegex    = regexp.MustCompile(`(?s)<li>(.*?)</li>`)
+	downloadQualityRegex = regexp.MustCompile(`(?s)<strong>(.*?)</strong>`)
+	downloadLinkRegex    = regexp.MustCompile(`(?s)<a[^>]+href="([^"]+)"[^>]*>(.*?)</a>`)
+	downloadSizeRegex    = regexp.MustCompile(`(?i)(\d+(?:[.,]\d+)?\s*[KMG]B)\b`)
+	htmlTagRegex         = regexp.MustCompile(`<[^>]*>`)
+)
+
+// parseDownloads returns the download links of the episode page, listed by
+// format and then by quality.
+func parseDownloads(page string) []*model.Download {
+	var downloads []*model.Download
+	for _, section := range downloadSectionRegex.FindAllStringSubmatch(page, -1) {
+		var format string
+		if match := downloadFormatRegex.FindStringSubmatch(section[1]); match != nil {
+			// e.g. "x265 [Mode Irit Kuota]"
+			if fields := strings.Fields(htmlTagRegex.ReplaceAllString(match[1], "")); len(fields) > 0 {
+				format = strings.ToLower(fields[0])
+			}
+		}
+
+		for _, item := range downloadItemRegex.FindAllStringSubmatch(section[1], -1) {
+			var quality, size string
+			if match := downloadQualityRegex.FindStringSubmatch(item[1]); match != nil {
+				label := html.UnescapeString(htmlTagRegex.ReplaceAllString(match[1], ""))
+				quality = model.ParseQuality(label)
+				if quality == "" {
+					quality = strings.TrimSpace(label)
+				}
+				if match := downloadSizeRegex.FindStringSubmatch(label); match != nil {
+					size = strings.ToUpper(match[1])
+				}
+			}
+
+			for _, link := range downloadLinkRegex.FindAllStringSubmatch(item[1], -1) {
+				downloadURL := html.UnescapeString(link[1])
+				u, err := url.Parse(downloadURL)
+				if err != nil || u.Host == "" {
+					continue
+				}
+
+				downloads = append(downloads, &model.Download{
+					Format:  format,
+					Quality: quality,
+					Host:    strings.TrimPrefix(u.Hostname(), "www."),
+					Name:    strings.TrimSpace(html.UnescapeString(htmlTagRegex.ReplaceAllString(link[2], ""))),
+					URL:     downloadURL,
+					Size:    size,
+				})
+			}
+		}
+	}
+
+	return downloads
 }
 
-func (f *Fetcher) GetAnimeBySearch(ctx context.Context, db db.DBInterface, query *string) ([]*model.SimpleAnime, error) {
-	anime := []*model.SimpleAnime{}
+// GetAnimeBySearch returns the anime matching the query upstream, it does
+// not store anything, see catalog.Catalog.SaveSearchResults.
+func (f *Fetcher) GetAnimeBySearch(ctx context.Context, query *string) ([]*model.Anime, error) {
+	anime := []*model.Anime{}
 	if query == nil {
 		return anime, nil
 	}
@@ -453,39 +556,39 @@ func (f *Fetcher) GetAnimeBySearch(ctx context.Context, db db.DBInterface, query
 	}
 
 	for _, e := range easthemeMap {
-		var _anime model.SimpleAnime
-		_anime.Title = e.Title
+		var _anime model.Anime
+		_anime.Title = strings.TrimSpace(e.Title)
 		_anime.CoverURL = e.Img
+		_anime.Type = model.ParseAnimeType(e.Data.Type)
+		if e.Data.Score != "" {
+			score := e.Data.Score
+			_anime.ScoreRaw = &score
+		}
 
 		eLink := strings.Replace(e.URL, "/anime", "", 1)
 		for _, c := range categories {
 			if eLink == c.Link {
-				_anime.AnimeID = c.ID
+				_anime.ID = c.ID
 				break
 			}
 		}
 
-		if _anime.AnimeID == 0 {
+		if _anime.ID == 0 {
 			continue
 		}
 
-		var temp model.Anime
-		temp.ID = _anime.AnimeID
-		temp.Title = _anime.Title
-		temp.CoverURL = _anime.CoverURL
-
 		slug, err := MatchStringByRegex(`http.*\/(.*)\/`, eLink)
 		if err != nil {
 			log.Error().Err(err).Msg("fetcher.GetAnimeBySearch: failed to parse slug")
 			return nil, err
 		}
-		temp.Slug = *slug
-
-		if err := temp.Save(db, true); err != nil {
-			return nil, err
+		if slug == nil {
+			log.Error().Msg("fetcher.GetAnimeBySearch: failed to parse slug")
+			continue
 		}
+		_anime.Slug = *slug
 
-		_anime.CoverURL = fmt.Sprintf(os.Getenv("API_URL")+"/anime/%d/cover", _anime.AnimeID)
+		_anime.Normalize()
 		anime = append(anime, &_anime)
 	}
 
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"animenya.site/model"
+)
+
+func TestParseDownloads(t *testing.T) {
+	page, err := os.ReadFile("testdata/episode.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []model.Download{
+		{Format: "mkv", Quality: "360p", Host: "gofile.io", Name: "Gofile", URL: "https://gofile.io/d/aaa111"},
+		{Format: "mkv", Quality: "360p", Host: "pixeldrain.com", Name: "Pixeldrain", URL: "https://www.pixeldrain.com/u/bbb222"},
+		{Format: "mkv", Quality: "720p", Host: "krakenfiles.com", Name: "Krakenfiles", URL: "https://krakenfiles.com/view/ccc333/file.html"},
+		{Format: "x265", Quality: "1080p", Host: "mega.nz", Name: "Mega & Co", URL: "https://mega.nz/file/ddd444#key", Size: "350 MB"},
+	}
+
+	got := parseDownloads(string(page))
+	if len(got) != len(want) {
+		t.Fatalf("got %d downloads, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("download %d: got %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+
+	if got := parseDownloads(`<div class="download-eps"></div>`); len(got) != 0 {
+		t.Errorf("empty section: got %d downloads", len(got))
+	}
+}
+
+// serveSource serves the fixtures of the pages and answers every player ajax
+// request with the player.
+func serveSource(t *testing.T, pages map[string]string, player string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wp-admin/admin-ajax.php" {
+			w.Write([]byte(player))
+			return
+		}
+
+		fixture, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		page, err := os.ReadFile("testdata/" + fixture)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("SOURCE_URL", server.URL)
+	t.Setenv("ZENROWS_KEY", "")
+}
+
+func TestGetEpisodeByEpisodeIDAndEpisodeSlug(t *testing.T) {
+	serveSource(t, map[string]string{
+		"/anime-episode-1":    "episode.html",
+		"/anime-episode-1-12": "episode_batch.html",
+	}, `<iframe src="https://www.blogger.com/video.g?token=abc" FRAMEBORDER="0"></iframe>`)
+
+	tests := []struct {
+		slug      string
+		err       string
+		watches   []string
+		downloads int
+	}{
+		{slug: "anime-episode-1", watches: []string{"https://www.blogger.com/video.g?token=abc"}, downloads: 4},
+		// a batch page has no player, only downloads
+		{slug: "anime-episode-1-12", watches: []string{}, downloads: 2},
+		{slug: "missing-episode", err: "STATUS_CODE_NOT_OK"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.slug, func(t *testing.T) {
+			id, slug := 12345, test.slug
+			episode, err := NewFetcher().GetEpisodeByEpisodeIDAndEpisodeSlug(context.Background(), &id, &slug)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			watches := []string{}
+			for _, watch := range episode.Watches {
+				watches = append(watches, watch.StreamURL)
+			}
+			if !reflect.DeepEqual(watches, test.watches) {
+				t.Errorf("watches %v, want %v", watches, test.watches)
+			}
+			if episode.Watches == nil {
+				t.Error("watches are nil, want empty")
+			}
+			if len(episode.Downloads) != test.downloads {
+				t.Errorf("%d downloads, want %d", len(episode.Downloads), test.downloads)
+			}
+			if episode.WatchesFetchedAt == nil || episode.DownloadsFetchedAt == nil {
+				t.Error("fetch time is not set")
+			}
+		})
+	}
+}
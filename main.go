@@ -1,42 +1,142 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"animenya.site/catalog"
 	"animenya.site/db"
 	"animenya.site/handler"
+	"animenya.site/imagecache"
 	"animenya.site/lib"
+	"animenya.site/model"
 	"animenya.site/router"
+	"animenya.site/search"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cache"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// refreshWorkers is the number of anime refreshed in the background at once
+	refreshWorkers = 2
+	// previewWorkers is the number of cover previews computed at once
+	previewWorkers = 1
+	// healthCheckInterval is the pause between two scans of the stream links
+	healthCheckInterval = time.Hour
+	// cacheMaxBytes is the memory the response cache may use
+	cacheMaxBytes = 64 << 20
+	// shutdownTimeout is how long the running requests and refreshes may take
+	// to finish on shutdown
+	shutdownTimeout = time.Second * 30
 )
 
 func main() {
-	app := fiber.New()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate()
+		return
+	}
+
+	// behind a reverse proxy the client address is read from its header, e.g.
+	// PROXY_HEADER=X-Forwarded-For, for the rate limits and reports. The header
+	// is only read on requests coming from TRUSTED_PROXIES, comma separated
+	// addresses or ranges, since anyone else can set it.
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if os.Getenv("PROXY_HEADER") != "" && len(trustedProxies) == 0 {
+		log.Warn().Msg("main: PROXY_HEADER is ignored until TRUSTED_PROXIES is set")
+	}
+
+	app := fiber.New(fiber.Config{
+		ProxyHeader:             os.Getenv("PROXY_HEADER"),
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          trustedProxies,
+		EnableIPValidation:      true,
+	})
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowMethods: "GET",
+		AllowMethods: "GET,POST",
 	}))
 	app.Use(cache.New(cache.Config{
+		Next: func(c *fiber.Ctx) bool {
+			// the cache reads the whole body, media and images must be streamed
+			return strings.HasPrefix(c.Path(), "/stream/") || strings.HasSuffix(c.Path(), "/cover") || strings.HasSuffix(c.Path(), "/thumbnail")
+		},
 		ExpirationGenerator: func(c *fiber.Ctx, cfg *cache.Config) time.Duration {
 			expiration := time.Hour * 2
 			newCacheTime, _ := strconv.Atoi(c.GetRespHeader("Cache-Time", fmt.Sprintf("%.0f", expiration.Seconds())))
 			return time.Second * time.Duration(newCacheTime)
 		},
 		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.Path()
+			// filters are passed as query params, so they are part of the key
+			return c.OriginalURL()
 		},
+		// arbitrary query params make distinct keys, bound the memory they use
+		MaxBytes: cacheMaxBytes,
 	}))
 
 	db := db.New()
 	fetch := lib.NewFetcher()
-	handler := handler.New(fetch, db)
+	index := search.New()
+	model.OnSave(index.Add)
+	go func() {
+		if err := index.Build(db); err != nil {
+			log.Error().Err(err).Msg("main: failed to build search index")
+		}
+	}()
+	images := imagecache.New(db)
+	if err := images.Load(); err != nil {
+		log.Error().Err(err).Msg("main: failed to load image cache")
+	}
+	catalog := catalog.New(db, fetch, images)
+	catalog.Start(refreshWorkers)
+	catalog.StartPreviews(previewWorkers)
+	go catalog.BackfillPreviews()
+	catalog.StartHealthCheck(healthCheckInterval)
+	model.OnSave(catalog.EnqueuePreview)
+	handler := handler.New(fetch, db, index, catalog, images)
 
 	router.SetupRoutes(app, handler)
-	app.Listen(fmt.Sprintf(":%s", os.Getenv("PORT")))
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-quit
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			log.Error().Err(err).Msg("main: failed to shut down the server")
+		}
+	}()
+
+	if err := app.Listen(fmt.Sprintf(":%s", os.Getenv("PORT"))); err != nil {
+		log.Error().Err(err).Msg("main: failed to listen")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := catalog.Stop(ctx); err != nil {
+		log.Error().Err(err).Msg("main: refreshes still running at shutdown")
+	}
+}
+
+// migrate upgrades every stored record to the current schema version, run it
+// with `animnya-api.site migrate` after deploying a model change.
+func migrate() {
+	total, err := model.MigrateAnime(db.New())
+	if err != nil {
+		log.Fatal().Err(err).Int("migrated", total).Msg("main.migrate: failed to migrate anime")
+	}
+
+	log.Info().Int("migrated", total).Int("schema_version", model.AnimeSchemaVersion).Msg("main.migrate: anime migrated")
 }
@@ -3,31 +3,84 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"animenya.site/data"
 	"animenya.site/db"
+	"github.com/rs/zerolog/log"
 )
 
 type Anime struct {
-	ID            int        `json:"id"`
-	PostID        *int       `json:"post_id,omitempty"`
-	Title         string     `json:"title"`
-	Slug          string     `json:"slug"`
-	Duration      *string    `json:"duration,omitempty"`
-	Genre         *[]Genre   `json:"genre,omitempty"`
-	Score         *string    `json:"score,omitempty"`
-	Status        *string    `json:"status,omitempty"`
-	Synopsis      *string    `json:"synopsis,omitempty"`
-	CoverURL      string     `json:"cover_url"`
-	TrailerURL    *string    `json:"trailer_url,omitempty"`
-	TotalEpisode  *string    `json:"total_episodes,omitempty"`
-	Studio        *string    `json:"studio,omitempty"`
-	Season        *string    `json:"season,omitempty"`
-	ReleaseDate   *string    `json:"release_date,omitempty"`
-	Episodes      []*Episode `json:"episodes,omitempty"`
-	CacheExpireAt *time.Time `json:"cache_expire_at,omitempty"`
+	ID                int         `json:"id"`
+	PostID            *int        `json:"post_id,omitempty"`
+	Title             string      `json:"title"`
+	Slug              string      `json:"slug"`
+	AlternativeTitles []string    `json:"alternative_titles,omitempty"`
+	Type              AnimeType   `json:"type,omitempty"`
+	DurationMinutes   int         `json:"duration_minutes,omitempty"`
+	Genre             *[]Genre    `json:"genre,omitempty"`
+	Score             float64     `json:"score,omitempty"`
+	Status            AnimeStatus `json:"status,omitempty"`
+	Synopsis          *string     `json:"synopsis,omitempty"`
+	CoverURL          string      `json:"cover_url"`
+	TrailerURL        *string     `json:"trailer_url,omitempty"`
+	TotalEpisodes     *int        `json:"total_episodes,omitempty"`
+	Studio            *string     `json:"studio,omitempty"`
+	Season            *string     `json:"season,omitempty"`
+	ReleaseDate       *string     `json:"release_date,omitempty"`
+	Episodes          []*Episode  `json:"episodes,omitempty"`
+	SchemaVersion     int         `json:"schema_version,omitempty"`
+
+	// when each section was last fetched from the source, see TTLFor
+	MetadataFetchedAt *time.Time `json:"metadata_fetched_at,omitempty"`
+	EpisodesFetchedAt *time.Time `json:"episodes_fetched_at,omitempty"`
+
+	// computed from the cover in the background, CoverPreviewOf is the cover
+	// URL they were computed from
+	CoverBlurhash  string `json:"cover_blurhash,omitempty"`
+	CoverColor     string `json:"cover_color,omitempty"`
+	CoverPreviewOf string `json:"cover_preview_of,omitempty"`
+
+	// raw strings as scraped from the source, kept for debugging
+	TitleRaw        *string `json:"title_raw,omitempty"`
+	DurationRaw     *string `json:"duration_raw,omitempty"`
+	ScoreRaw        *string `json:"score_raw,omitempty"`
+	StatusRaw       *string `json:"status_raw,omitempty"`
+	TotalEpisodeRaw *string `json:"total_episodes_raw,omitempty"`
+	ReleaseDateRaw  *string `json:"release_date_raw,omitempty"`
+}
+
+type AnimeType string
+
+const (
+	AnimeTypeTV      AnimeType = "tv"
+	AnimeTypeMovie   AnimeType = "movie"
+	AnimeTypeOVA     AnimeType = "ova"
+	AnimeTypeONA     AnimeType = "ona"
+	AnimeTypeSpecial AnimeType = "special"
+)
+
+// ParseAnimeType normalizes the type label used by the source ("TV",
+// "Movie", "OVA", ...) and returns an empty type when it is unknown.
+func ParseAnimeType(str string) AnimeType {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "tv", "tv series", "series":
+		return AnimeTypeTV
+	case "movie", "movies", "film":
+		return AnimeTypeMovie
+	case "ova", "oad":
+		return AnimeTypeOVA
+	case "ona", "web":
+		return AnimeTypeONA
+	case "special", "specials", "sp", "tv special":
+		return AnimeTypeSpecial
+	}
+
+	return ""
 }
 
 type Genre struct {
@@ -35,6 +88,8 @@ type Genre struct {
 	Slug string `json:"slug"`
 }
 
+// Get reads the anime from the db. Older records are migrated in memory only,
+// Get never writes, they are saved by the next Update or by MigrateAnime.
 func (a *Anime) Get(db db.DBInterface) error {
 	if a.ID == 0 {
 		return fmt.Errorf("ID_IS_ZERO")
@@ -46,25 +101,47 @@ func (a *Anime) Get(db db.DBInterface) error {
 		return err
 	}
 
-	err = json.Unmarshal(*content, a)
-	if err != nil {
+	if _, err := a.decode(*content); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (a *Anime) Save(db db.DBInterface, forceSave bool) error {
-	if !forceSave {
-		if a.CacheExpireAt == nil {
-			cacheExpireAt := time.Now().Add(time.Hour * 24 * 3) // 3 days
-			a.CacheExpireAt = &cacheExpireAt
-		} else if a.CacheExpireAt.Before(time.Now()) {
-			cacheExpireAt := time.Now().Add(time.Hour * 24 * 3) // 3 days
-			a.CacheExpireAt = &cacheExpireAt
+// ListAnime returns every anime stored in the db, newest id first.
+func ListAnime(db db.DBInterface) ([]*Anime, error) {
+	ids, err := db.List(data.DBAnime)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Anime
+	for _, id := range ids {
+		animeID, err := strconv.Atoi(id)
+		if err != nil {
+			continue
 		}
+
+		anime := Anime{ID: animeID}
+		if err := anime.Get(db); err != nil {
+			log.Error().Err(err).Str("anime_id", id).Msg("model.ListAnime: skipping unreadable anime")
+			continue
+		}
+
+		result = append(result, &anime)
 	}
 
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID > result[j].ID
+	})
+
+	return result, nil
+}
+
+func (a *Anime) Save(db db.DBInterface) error {
+	a.Normalize()
+	a.SchemaVersion = AnimeSchemaVersion
+
 	_content, err := json.Marshal(a)
 	if err != nil {
 		return err
@@ -76,138 +153,56 @@ func (a *Anime) Save(db db.DBInterface, forceSave bool) error {
 		return err
 	}
 
-	return nil
-}
-
-func (a *Anime) IsDataComplete() bool {
-	if a.PostID == nil {
-		return false
-	}
-	if a.ID == 0 {
-		return false
-	}
-
-	if a.Title == "" {
-		return false
-	}
-
-	if a.Slug == "" {
-		return false
-	}
-
-	if a.Synopsis == nil {
-		return false
+	for _, hook := range saveHooks {
+		hook(a)
 	}
 
-	if a.TrailerURL == nil {
-		return false
-	}
+	return nil
+}
 
-	if a.CoverURL == "" {
-		return false
-	}
+// SaveAnimeBatch saves every anime at once, see db.SaveBatch. The save hooks
+// only run once every anime was saved.
+func SaveAnimeBatch(db db.DBInterface, anime []*Anime) error {
+	contents := map[string][]byte{}
+	for _, a := range anime {
+		a.Normalize()
+		a.SchemaVersion = AnimeSchemaVersion
 
-	if a.TotalEpisode == nil {
-		return false
-	}
-
-	if a.Studio == nil {
-		return false
+		content, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		contents[strconv.Itoa(a.ID)] = content
 	}
 
-	if a.Season == nil {
-		return false
+	if err := db.SaveBatch(data.DBAnime, contents); err != nil {
+		return err
 	}
 
-	if a.ReleaseDate == nil {
-		return false
+	for _, a := range anime {
+		for _, hook := range saveHooks {
+			hook(a)
+		}
 	}
 
-	return true
+	return nil
 }
 
-func (a *Anime) IsCacheExpired() bool {
-	if a.CacheExpireAt == nil {
-		return true
-	}
-
-	if a.CacheExpireAt.Before(time.Now()) {
-		return true
-	}
+// saveHooks are called after every successful Save, see OnSave.
+var saveHooks []func(a *Anime)
 
-	return false
+// OnSave registers a hook called with the anime after it has been saved, it
+// is used to keep derived data like the search index up to date.
+func OnSave(hook func(a *Anime)) {
+	saveHooks = append(saveHooks, hook)
 }
 
 func (a *Anime) Update(db db.DBInterface, updatedAnime *Anime) error {
-	if !a.IsDataComplete() || a.IsCacheExpired() {
-		a.Title = updatedAnime.Title
-
-		if updatedAnime.PostID != nil {
-			a.PostID = updatedAnime.PostID
-		}
-
-		if updatedAnime.Slug != "" {
-			a.Slug = updatedAnime.Slug
-		}
+	*a = *Merge(a, updatedAnime)
 
-		if updatedAnime.Duration != nil {
-			a.Duration = updatedAnime.Duration
-		}
-
-		if updatedAnime.Genre != nil {
-			a.Genre = updatedAnime.Genre
-		}
-
-		if updatedAnime.Score != nil {
-			a.Score = updatedAnime.Score
-		}
-
-		if updatedAnime.Status != nil {
-			a.Status = updatedAnime.Status
-		}
-
-		if updatedAnime.Synopsis != nil {
-			a.Synopsis = updatedAnime.Synopsis
-		}
-
-		if updatedAnime.TrailerURL != nil {
-			a.TrailerURL = updatedAnime.TrailerURL
-		}
-
-		if updatedAnime.CoverURL != "" {
-			a.CoverURL = updatedAnime.CoverURL
-		}
-
-		if updatedAnime.TotalEpisode != nil {
-			a.TotalEpisode = updatedAnime.TotalEpisode
-		}
-
-		if updatedAnime.Studio != nil {
-			a.Studio = updatedAnime.Studio
-		}
-
-		if updatedAnime.Season != nil {
-			a.Season = updatedAnime.Season
-		}
-
-		if updatedAnime.ReleaseDate != nil {
-			a.ReleaseDate = updatedAnime.ReleaseDate
-		}
-
-		if updatedAnime.Episodes != nil {
-			a.Episodes = updatedAnime.Episodes
-		}
-
-		if updatedAnime.Episodes != nil {
-			a.Episodes = updatedAnime.Episodes
-		}
-
-		err := a.Save(db, false)
-		if err != nil {
-			return err
-		}
-
-		return nil
+	err := a.Save(db)
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -242,22 +237,152 @@ func (a *Anime) ReOrderedEpisodes() {
 }
 
 type Episode struct {
-	ID        int        `json:"id"`
-	Slug      string     `json:"slug"`
-	Anime     *Anime     `json:"anime,omitempty"`
-	Episode   string     `json:"episode"`
-	Watches   []*Watch   `json:"watches,omitempty"`
-	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ID        int           `json:"id"`
+	Slug      string        `json:"slug"`
+	Anime     *Anime        `json:"anime,omitempty"`
+	Episode   string        `json:"episode"`
+	Number    *float64      `json:"number,omitempty"`
+	Range     *EpisodeRange `json:"range,omitempty"`
+	Kind      EpisodeKind   `json:"kind,omitempty"`
+	Watches   []*Watch      `json:"watches,omitempty"`
+	Downloads []*Download   `json:"downloads,omitempty"`
+	// ThumbnailURL is the source screenshot of the episode, the responses
+	// point to the thumbnail endpoint instead
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	// Subtitles lists the languages of the watches subtitles, served by the
+	// API as WebVTT. It is set for the response and never stored
+	Subtitles []*Subtitle     `json:"subtitles,omitempty"`
+	Previous  *EpisodeSummary `json:"previous,omitempty"`
+	Next      *EpisodeSummary `json:"next,omitempty"`
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+
+	WatchesFetchedAt *time.Time `json:"watches_fetched_at,omitempty"`
+	// WatchesFailedAt is the last failed fetch of the watches, see
+	// Episode.IsWatchesStale
+	WatchesFailedAt *time.Time `json:"watches_failed_at,omitempty"`
+	// DownloadsFetchedAt is set even when the episode has no download
+	DownloadsFetchedAt *time.Time `json:"downloads_fetched_at,omitempty"`
 }
 
 type Watch struct {
 	ID        int    `json:"id"`
 	Source    string `json:"source"`
 	StreamURL string `json:"stream_url"`
+	Host      string `json:"host,omitempty"`
+	// Server, Quality, Format, Language and Translation are parsed from the
+	// player title and the sources, see Watch.Normalize
+	Server      string           `json:"server,omitempty"`
+	Quality     string           `json:"quality,omitempty"`
+	Format      WatchFormat      `json:"format,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Translation WatchTranslation `json:"translation,omitempty"`
+	// Sources are the direct media URLs of the stream, when its host is known
+	Sources   []*Source   `json:"sources,omitempty"`
+	Subtitles []*Subtitle `json:"subtitles,omitempty"`
+
+	FetchedAt      *time.Time `json:"fetched_at,omitempty"`
+	LastVerifiedAt *time.Time `json:"last_verified_at,omitempty"`
+	// BrokenAt is set when a client reports the stream as dead
+	BrokenAt *time.Time   `json:"broken_at,omitempty"`
+	Health   *WatchHealth `json:"health,omitempty"`
+}
+
+// WatchHealth is the result of the last checks of the stream URL, the last
+// successful check is Watch.LastVerifiedAt.
+type WatchHealth struct {
+	StatusCode          int        `json:"status_code"`
+	LatencyMS           int64      `json:"latency_ms"`
+	CheckedAt           *time.Time `json:"checked_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// NewWatch returns a watch scraped just now.
+func NewWatch(id int, source string, streamURL string) *Watch {
+	now := time.Now()
+	watch := Watch{
+		ID:             id,
+		Source:         source,
+		StreamURL:      streamURL,
+		FetchedAt:      &now,
+		LastVerifiedAt: &now,
+	}
+
+	if u, err := url.Parse(streamURL); err == nil {
+		watch.Host = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	watch.Normalize()
+
+	return &watch
 }
 
 type SimpleAnime struct {
-	AnimeID  int    `json:"id"`
-	CoverURL string `json:"cover_url"`
-	Title    string `json:"title"`
+	AnimeID       int       `json:"id"`
+	CoverURL      string    `json:"cover_url"`
+	CoverBlurhash string    `json:"cover_blurhash,omitempty"`
+	CoverColor    string    `json:"cover_color,omitempty"`
+	Title         string    `json:"title"`
+	Type          AnimeType `json:"type,omitempty"`
+}
+
+type EpisodeSummary struct {
+	ID      int         `json:"id"`
+	Slug    string      `json:"slug"`
+	Episode string      `json:"episode"`
+	Number  *float64    `json:"number,omitempty"`
+	Kind    EpisodeKind `json:"kind,omitempty"`
+}
+
+type EpisodeSiblings struct {
+	Previous *EpisodeSummary `json:"previous"`
+	Next     *EpisodeSummary `json:"next"`
+}
+
+func (e *Episode) Summary() *EpisodeSummary {
+	if e == nil {
+		return nil
+	}
+
+	return &EpisodeSummary{
+		ID:      e.ID,
+		Slug:    e.Slug,
+		Episode: e.Episode,
+		Number:  e.Number,
+		Kind:    e.Kind,
+	}
+}
+
+// EpisodeSiblings returns the episodes aired right before and right after the
+// given episode, based on the ordered episode list of the anime.
+func (a *Anime) EpisodeSiblings(episodeID int) (*EpisodeSiblings, error) {
+	a.ReOrderedEpisodes()
+
+	for i, episode := range a.Episodes {
+		if episode.ID != episodeID {
+			continue
+		}
+
+		// episodes are ordered from the newest to the oldest
+		var siblings EpisodeSiblings
+		if i+1 < len(a.Episodes) {
+			siblings.Previous = a.Episodes[i+1].Summary()
+		}
+		if i > 0 {
+			siblings.Next = a.Episodes[i-1].Summary()
+		}
+
+		return &siblings, nil
+	}
+
+	return nil, fmt.Errorf("EPISODE_NOT_FOUND")
+}
+
+// Download is a download mirror of an episode.
+type Download struct {
+	// Format is the container or encoding, e.g. mkv, mp4 or x265
+	Format  string `json:"format"`
+	Quality string `json:"quality"`
+	Host    string `json:"host"`
+	Name    string `json:"name,omitempty"`
+	URL     string `json:"url"`
+	Size    string `json:"size,omitempty"`
 }
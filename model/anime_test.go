@@ -0,0 +1,77 @@
+package model
+
+import "testing"
+
+func TestEpisodeSiblings(t *testing.T) {
+	anime := Anime{Episodes: []*Episode{
+		{ID: 20, Slug: "episode-2"},
+		{ID: 10, Slug: "episode-1"},
+		{ID: 30, Slug: "episode-3"},
+	}}
+
+	tests := []struct {
+		episodeID int
+		previous  int
+		next      int
+		err       string
+	}{
+		{episodeID: 10, next: 20},
+		{episodeID: 20, previous: 10, next: 30},
+		{episodeID: 30, previous: 20},
+		{episodeID: 40, err: "EPISODE_NOT_FOUND"},
+	}
+
+	id := func(summary *EpisodeSummary) int {
+		if summary == nil {
+			return 0
+		}
+		return summary.ID
+	}
+
+	for _, test := range tests {
+		siblings, err := anime.EpisodeSiblings(test.episodeID)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%d: error %v, want %s", test.episodeID, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", test.episodeID, err)
+			continue
+		}
+
+		if id(siblings.Previous) != test.previous || id(siblings.Next) != test.next {
+			t.Errorf("%d: previous %d and next %d, want %d and %d", test.episodeID, id(siblings.Previous), id(siblings.Next), test.previous, test.next)
+		}
+	}
+
+	single := Anime{Episodes: []*Episode{{ID: 10}}}
+	siblings, err := single.EpisodeSiblings(10)
+	if err != nil || siblings.Previous != nil || siblings.Next != nil {
+		t.Errorf("single episode: got %+v, %v", siblings, err)
+	}
+}
+
+func TestParseAnimeType(t *testing.T) {
+	tests := map[string]AnimeType{
+		"TV":         AnimeTypeTV,
+		" tv series": AnimeTypeTV,
+		"Movie":      AnimeTypeMovie,
+		"film":       AnimeTypeMovie,
+		"OVA":        AnimeTypeOVA,
+		"OAD":        AnimeTypeOVA,
+		"ONA":        AnimeTypeONA,
+		"Web":        AnimeTypeONA,
+		"Special":    AnimeTypeSpecial,
+		"TV Special": AnimeTypeSpecial,
+		"":           "",
+		"Music":      "",
+	}
+
+	for str, want := range tests {
+		if got := ParseAnimeType(str); got != want {
+			t.Errorf("ParseAnimeType(%q) = %q, want %q", str, got, want)
+		}
+	}
+}
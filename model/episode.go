@@ -0,0 +1,120 @@
+package model
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type EpisodeKind string
+
+const (
+	EpisodeKindEpisode EpisodeKind = "episode"
+	EpisodeKindSpecial EpisodeKind = "special"
+	EpisodeKindOVA     EpisodeKind = "ova"
+	EpisodeKindMovie   EpisodeKind = "movie"
+	EpisodeKindBatch   EpisodeKind = "batch"
+)
+
+type EpisodeRange struct {
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+}
+
+var (
+	episodeMarkerRegex = regexp.MustCompile(`(?i)\s*\b(?:episode|epsiode)\b\.?\s*`)
+	episodeRangeRegex  = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(?:-|~|s/d|sampai)\s*(\d+(?:\.\d+)?)`)
+	episodeNumberRegex = regexp.MustCompile(`\d+(?:\.\d+)?`)
+	episodeKindRegexes = []struct {
+		kind  EpisodeKind
+		regex *regexp.Regexp
+	}{
+		{EpisodeKindBatch, regexp.MustCompile(`(?i)\bbatch\b`)},
+		{EpisodeKindMovie, regexp.MustCompile(`(?i)\b(?:movie|film)\b`)},
+		{EpisodeKindOVA, regexp.MustCompile(`(?i)\b(?:ova|oad|ona)\b`)},
+		{EpisodeKindSpecial, regexp.MustCompile(`(?i)\b(?:special|sp)\b`)},
+	}
+	episodeSuffixRegex = regexp.MustCompile(`(?i)\s*\b(?:sub(?:title)?\s+indo(?:nesia)?)\b.*$`)
+)
+
+// ParseEpisodeTitle parses a post title such as "One Piece Episode 1119" or
+// "Kimi no Na wa Movie" into the episode fields and returns the anime title.
+func (e *Episode) ParseEpisodeTitle(title string) string {
+	return e.parse(title, false)
+}
+
+// ParseEpisode parses an episode label such as "12", "12.5" or "1-12 Batch"
+// coming from the anime detail data.
+func (e *Episode) ParseEpisode(episode string) {
+	e.parse(episode, true)
+}
+
+func (e *Episode) parse(str string, bareNumber bool) string {
+	str = strings.TrimSpace(episodeSuffixRegex.ReplaceAllString(str, ""))
+
+	title := str
+	label := ""
+	hasMarker := false
+	if loc := episodeMarkerRegex.FindStringIndex(str); loc != nil {
+		title = str[:loc[0]]
+		label = str[loc[1]:]
+		hasMarker = true
+	}
+
+	// with a marker the kind is only looked for in the label after it, the
+	// title may carry words like "SP" that are part of the anime name
+	kindIn := str
+	if hasMarker {
+		kindIn = label
+	}
+
+	e.Kind = ""
+	for _, k := range episodeKindRegexes {
+		loc := k.regex.FindStringIndex(kindIn)
+		if loc == nil {
+			continue
+		}
+
+		e.Kind = k.kind
+		if !hasMarker && !bareNumber {
+			title = str[:loc[0]]
+			label = str[loc[0]:]
+		}
+		break
+	}
+
+	if e.Kind == "" {
+		if hasMarker || (bareNumber && episodeNumberRegex.MatchString(str)) {
+			e.Kind = EpisodeKindEpisode
+		} else {
+			// a post without any episode number is most likely a movie
+			e.Kind = EpisodeKindMovie
+		}
+	}
+
+	// detail labels have no title, the whole label is the episode
+	if !hasMarker && (bareNumber || e.Kind == EpisodeKindEpisode) {
+		label = str
+	}
+
+	e.Number = nil
+	e.Range = nil
+	if match := episodeRangeRegex.FindStringSubmatch(label); match != nil {
+		from, _ := strconv.ParseFloat(match[1], 64)
+		to, _ := strconv.ParseFloat(match[2], 64)
+		e.Range = &EpisodeRange{From: from, To: to}
+		if e.Kind == EpisodeKindEpisode {
+			e.Kind = EpisodeKindBatch
+		}
+	} else if match := episodeNumberRegex.FindString(label); match != "" {
+		number, _ := strconv.ParseFloat(match, 64)
+		e.Number = &number
+	}
+
+	e.Episode = strings.TrimSpace(label)
+	if title == "" {
+		title = str
+	}
+
+	return strings.TrimSpace(title)
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEpisode(t *testing.T) {
+	float := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		label  string
+		kind   EpisodeKind
+		number *float64
+		rng    *EpisodeRange
+	}{
+		{"12", EpisodeKindEpisode, float(12), nil},
+		{"12.5", EpisodeKindEpisode, float(12.5), nil},
+		{"1-12 Batch", EpisodeKindBatch, nil, &EpisodeRange{From: 1, To: 12}},
+		{"OVA 2", EpisodeKindOVA, float(2), nil},
+		{"Movie", EpisodeKindMovie, nil, nil},
+	}
+
+	for _, test := range tests {
+		var episode Episode
+		episode.ParseEpisode(test.label)
+
+		if episode.Kind != test.kind {
+			t.Errorf("%q: kind = %q, want %q", test.label, episode.Kind, test.kind)
+		}
+		if !reflect.DeepEqual(episode.Number, test.number) {
+			t.Errorf("%q: number = %v, want %v", test.label, episode.Number, test.number)
+		}
+		if !reflect.DeepEqual(episode.Range, test.rng) {
+			t.Errorf("%q: range = %v, want %v", test.label, episode.Range, test.rng)
+		}
+	}
+}
+
+func TestParseEpisodeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+		kind  EpisodeKind
+	}{
+		{"One Piece Episode 1119 Subtitle Indonesia", "One Piece", EpisodeKindEpisode},
+		{"Bleach OVA 2 Sub Indo", "Bleach", EpisodeKindOVA},
+		{"Kimi no Na wa", "Kimi no Na wa", EpisodeKindMovie},
+		{"Shingeki SP Episode 3", "Shingeki SP", EpisodeKindEpisode},
+		{"Bleach Episode 3 Special", "Bleach", EpisodeKindSpecial},
+		{"Boruto Episode 1-12 Batch", "Boruto", EpisodeKindBatch},
+	}
+
+	for _, test := range tests {
+		var episode Episode
+		if got := episode.ParseEpisodeTitle(test.title); got != test.want {
+			t.Errorf("%q: title = %q, want %q", test.title, got, test.want)
+		}
+		if episode.Kind != test.kind {
+			t.Errorf("%q: kind = %q, want %q", test.title, episode.Kind, test.kind)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// TTL is how long each section of an anime stays fresh before it is fetched
+// again from the source.
+type TTL struct {
+	Metadata time.Duration
+	Episodes time.Duration
+	Watches  time.Duration
+}
+
+// defaultTTLs are used unless overridden by the TTL_<STATUS>_<SECTION> env,
+// e.g. TTL_AIRING_EPISODES=30m. Anime without a known status use DEFAULT.
+var defaultTTLs = map[AnimeStatus]TTL{
+	AnimeStatusAiring: {
+		Metadata: time.Hour * 24,
+		Episodes: time.Hour,
+		Watches:  time.Hour * 24,
+	},
+	AnimeStatusUpcoming: {
+		Metadata: time.Hour * 24,
+		Episodes: time.Hour * 6,
+		Watches:  time.Hour * 24,
+	},
+	AnimeStatusFinished: {
+		Metadata: time.Hour * 24 * 30,
+		Episodes: time.Hour * 24 * 30,
+		Watches:  time.Hour * 24 * 7,
+	},
+	"": {
+		Metadata: time.Hour * 24 * 3,
+		Episodes: time.Hour * 24 * 3,
+		Watches:  time.Hour * 24 * 3,
+	},
+}
+
+func TTLFor(status AnimeStatus) TTL {
+	ttl, ok := defaultTTLs[status]
+	if !ok {
+		ttl = defaultTTLs[""]
+	}
+
+	name := strings.ToUpper(string(status))
+	if name == "" {
+		name = "DEFAULT"
+	}
+
+	ttl.Metadata = envDuration("TTL_"+name+"_METADATA", ttl.Metadata)
+	ttl.Episodes = envDuration("TTL_"+name+"_EPISODES", ttl.Episodes)
+	ttl.Watches = envDuration("TTL_"+name+"_WATCHES", ttl.Watches)
+	return ttl
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return duration
+}
+
+func isStale(fetchedAt *time.Time, ttl time.Duration) bool {
+	return fetchedAt == nil || fetchedAt.Add(ttl).Before(time.Now())
+}
+
+// IsMetadataStale reports whether the detail fields (synopsis, genre, score,
+// ...) should be fetched again.
+func (a *Anime) IsMetadataStale() bool {
+	return isStale(a.MetadataFetchedAt, TTLFor(a.Status).Metadata)
+}
+
+// IsEpisodesStale reports whether the episode list should be fetched again.
+func (a *Anime) IsEpisodesStale() bool {
+	return isStale(a.EpisodesFetchedAt, TTLFor(a.Status).Episodes)
+}
+
+// watchHostTTLs overrides the watches TTL for hosts whose stream URLs expire
+// sooner, matched on the host or its parent domain.
+var watchHostTTLs = map[string]time.Duration{
+	"blogger.com":     time.Hour * 2,
+	"googlevideo.com": time.Hour * 2,
+	"pixeldrain.com":  time.Hour * 24 * 7,
+	"mega.nz":         time.Hour * 24 * 7,
+}
+
+func watchTTL(host string, fallback time.Duration) time.Duration {
+	for {
+		if ttl, ok := watchHostTTLs[host]; ok {
+			return ttl
+		}
+
+		i := strings.Index(host, ".")
+		if i < 0 {
+			return fallback
+		}
+		host = host[i+1:]
+	}
+}
+
+// IsStale reports whether the watch should be scraped again, because its
+// host TTL passed or it was reported broken since it was fetched.
+func (w *Watch) IsStale(ttl time.Duration) bool {
+	if w.BrokenAt != nil && (w.FetchedAt == nil || w.BrokenAt.After(*w.FetchedAt)) {
+		return true
+	}
+
+	return isStale(w.FetchedAt, watchTTL(w.Host, ttl))
+}
+
+// watchesRetryAfter is the pause after a failed fetch of the watches, so a
+// dead source or a broken report is not retried on every read.
+const watchesRetryAfter = time.Minute * 15
+
+// IsWatchesStale reports whether the watches of the episode should be fetched
+// again, the status is the one of the parent anime.
+func (e *Episode) IsWatchesStale(status AnimeStatus) bool {
+	if e.WatchesFailedAt != nil && time.Since(*e.WatchesFailedAt) < watchesRetryAfter {
+		return false
+	}
+
+	// a fetch without any watch counts too, it is retried once the TTL passed
+	ttl := TTLFor(status).Watches
+	if len(e.Watches) == 0 {
+		return isStale(e.WatchesFetchedAt, ttl)
+	}
+
+	for _, watch := range e.Watches {
+		if watch.IsStale(ttl) {
+			return true
+		}
+	}
+
+	return false
+}
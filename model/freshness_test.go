@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsWatchesStale(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	tests := []struct {
+		name    string
+		episode Episode
+		want    bool
+	}{
+		{
+			name:    "never fetched",
+			episode: Episode{},
+			want:    true,
+		},
+		{
+			name:    "fresh",
+			episode: Episode{Watches: []*Watch{{FetchedAt: ago(time.Minute)}}},
+			want:    false,
+		},
+		{
+			name:    "reported broken",
+			episode: Episode{Watches: []*Watch{{FetchedAt: ago(time.Hour), BrokenAt: ago(time.Minute)}}},
+			want:    true,
+		},
+		{
+			name: "reported broken and the fetch just failed",
+			episode: Episode{
+				Watches:         []*Watch{{FetchedAt: ago(time.Hour), BrokenAt: ago(time.Minute * 2)}},
+				WatchesFailedAt: ago(time.Minute),
+			},
+			want: false,
+		},
+		{
+			name: "reported broken and the fetch failed a while ago",
+			episode: Episode{
+				Watches:         []*Watch{{FetchedAt: ago(time.Hour), BrokenAt: ago(time.Minute * 30)}},
+				WatchesFailedAt: ago(time.Minute * 20),
+			},
+			want: true,
+		},
+		{
+			name:    "failed without any watch",
+			episode: Episode{WatchesFailedAt: ago(time.Minute)},
+			want:    false,
+		},
+		{
+			name:    "failed without any watch a while ago",
+			episode: Episode{WatchesFailedAt: ago(time.Minute * 20)},
+			want:    true,
+		},
+		{
+			name:    "fetched without any watch",
+			episode: Episode{WatchesFetchedAt: ago(time.Minute)},
+			want:    false,
+		},
+		{
+			name:    "fetched without any watch past the TTL",
+			episode: Episode{WatchesFetchedAt: ago(TTLFor(AnimeStatusAiring).Watches + time.Minute)},
+			want:    true,
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.episode.IsWatchesStale(AnimeStatusAiring); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package model
+
+import "sort"
+
+// MaxWatchFailures is the number of consecutive failed health checks after
+// which a watch is hidden.
+const MaxWatchFailures = 3
+
+// IsHealthy reports whether the watch passed at least one of its last
+// MaxWatchFailures checks, unchecked watches are healthy.
+func (w *Watch) IsHealthy() bool {
+	return w.Health == nil || w.Health.ConsecutiveFailures < MaxWatchFailures
+}
+
+// HealthyWatches returns the healthy watches in the best order: by
+// healthRank, then highest quality, then formats playable without an embed,
+// then latency, and by ID for a deterministic result.
+func HealthyWatches(watches []*Watch) []*Watch {
+	result := []*Watch{}
+	for _, watch := range watches {
+		if watch.IsHealthy() {
+			result = append(result, watch)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if healthRank(a) != healthRank(b) {
+			return healthRank(a) < healthRank(b)
+		}
+
+		if QualityRank(a.Quality) != QualityRank(b.Quality) {
+			return QualityRank(a.Quality) > QualityRank(b.Quality)
+		}
+
+		if formatRank[a.Format] != formatRank[b.Format] {
+			return formatRank[a.Format] < formatRank[b.Format]
+		}
+
+		if a.Health != nil && b.Health != nil && a.Health.LatencyMS != b.Health.LatencyMS {
+			return a.Health.LatencyMS < b.Health.LatencyMS
+		}
+
+		return a.ID < b.ID
+	})
+
+	return result
+}
+
+// formatRank puts the direct sources before the embeds
+var formatRank = map[WatchFormat]int{
+	WatchFormatHLS:   0,
+	WatchFormatMP4:   1,
+	WatchFormatEmbed: 2,
+	"":               2,
+}
+
+// healthRank puts the watches passing their last check first, then the
+// unchecked ones, then the ones failing the least.
+func healthRank(w *Watch) int {
+	if w.Health == nil {
+		return 1
+	}
+	if w.Health.ConsecutiveFailures == 0 {
+		return 0
+	}
+
+	return 1 + w.Health.ConsecutiveFailures
+}
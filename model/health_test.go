@@ -0,0 +1,38 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHealthyWatches(t *testing.T) {
+	passing := &WatchHealth{LatencyMS: 300}
+	fast := &WatchHealth{LatencyMS: 100}
+	failing := &WatchHealth{ConsecutiveFailures: 1}
+	dead := &WatchHealth{ConsecutiveFailures: MaxWatchFailures}
+
+	watches := []*Watch{
+		{ID: 1, Quality: "1080p", Format: WatchFormatEmbed, Health: failing},
+		{ID: 2, Quality: "720p", Format: WatchFormatEmbed, Health: passing},
+		{ID: 3, Quality: "720p", Format: WatchFormatHLS, Health: passing},
+		{ID: 4, Quality: "720p", Format: WatchFormatHLS, Health: fast},
+		{ID: 5, Quality: "1080p", Format: WatchFormatMP4, Health: passing},
+		{ID: 6, Quality: "2160p", Format: WatchFormatHLS, Health: dead},
+		{ID: 7, Quality: "1080p", Format: WatchFormatHLS},
+		{ID: 8, Quality: "360p", Format: WatchFormatMP4},
+		{ID: 9, Format: WatchFormatEmbed, Health: passing},
+		{ID: 10, Quality: "720p", Format: WatchFormatHLS, Health: fast},
+	}
+
+	// passing checks first, then unchecked, then failing, dead ones are hidden,
+	// each by quality, format, latency and ID
+	want := []int{5, 4, 10, 3, 2, 9, 7, 8, 1}
+
+	ids := []int{}
+	for _, watch := range HealthyWatches(watches) {
+		ids = append(ids, watch.ID)
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+}
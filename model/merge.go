@@ -0,0 +1,209 @@
+package model
+
+import "time"
+
+// Merge returns the existing anime updated with the incoming data, every
+// write path goes through it so partial data never discards known fields:
+//   - scalar and pointer fields use the incoming value unless it is empty
+//   - alternative titles are unioned
+//   - episodes are unioned by ID and merged with the same rules
+//   - episode watches are kept unless the incoming ones are newer, otherwise
+//     only their health and broken reports are applied
+//   - episode downloads are replaced by newer ones, even empty, or by any
+//     non empty ones without a fetch time
+//
+// Neither argument is modified.
+func Merge(existing, incoming *Anime) *Anime {
+	if existing == nil {
+		existing = &Anime{}
+	}
+	if incoming == nil {
+		incoming = &Anime{}
+	}
+
+	merged := *existing
+	merged.ID = prefer(existing.ID, incoming.ID)
+	merged.PostID = prefer(existing.PostID, incoming.PostID)
+	merged.Title = prefer(existing.Title, incoming.Title)
+	merged.Slug = prefer(existing.Slug, incoming.Slug)
+	merged.AlternativeTitles = union(existing.AlternativeTitles, incoming.AlternativeTitles)
+	merged.Type = prefer(existing.Type, incoming.Type)
+	merged.DurationMinutes = prefer(existing.DurationMinutes, incoming.DurationMinutes)
+	merged.Score = prefer(existing.Score, incoming.Score)
+	merged.Status = prefer(existing.Status, incoming.Status)
+	merged.Synopsis = prefer(existing.Synopsis, incoming.Synopsis)
+	merged.CoverURL = prefer(existing.CoverURL, incoming.CoverURL)
+	merged.CoverBlurhash = prefer(existing.CoverBlurhash, incoming.CoverBlurhash)
+	merged.CoverColor = prefer(existing.CoverColor, incoming.CoverColor)
+	merged.CoverPreviewOf = prefer(existing.CoverPreviewOf, incoming.CoverPreviewOf)
+	merged.TrailerURL = prefer(existing.TrailerURL, incoming.TrailerURL)
+	merged.TotalEpisodes = prefer(existing.TotalEpisodes, incoming.TotalEpisodes)
+	merged.Studio = prefer(existing.Studio, incoming.Studio)
+	merged.Season = prefer(existing.Season, incoming.Season)
+	merged.ReleaseDate = prefer(existing.ReleaseDate, incoming.ReleaseDate)
+	merged.MetadataFetchedAt = latest(existing.MetadataFetchedAt, incoming.MetadataFetchedAt)
+	merged.EpisodesFetchedAt = latest(existing.EpisodesFetchedAt, incoming.EpisodesFetchedAt)
+	merged.TitleRaw = prefer(existing.TitleRaw, incoming.TitleRaw)
+	merged.DurationRaw = prefer(existing.DurationRaw, incoming.DurationRaw)
+	merged.ScoreRaw = prefer(existing.ScoreRaw, incoming.ScoreRaw)
+	merged.StatusRaw = prefer(existing.StatusRaw, incoming.StatusRaw)
+	merged.TotalEpisodeRaw = prefer(existing.TotalEpisodeRaw, incoming.TotalEpisodeRaw)
+	merged.ReleaseDateRaw = prefer(existing.ReleaseDateRaw, incoming.ReleaseDateRaw)
+
+	if incoming.Genre != nil && len(*incoming.Genre) > 0 {
+		merged.Genre = incoming.Genre
+	}
+
+	merged.Episodes = nil
+	index := map[int]int{}
+	for _, episode := range existing.Episodes {
+		index[episode.ID] = len(merged.Episodes)
+		merged.Episodes = append(merged.Episodes, MergeEpisode(nil, episode))
+	}
+	for _, episode := range incoming.Episodes {
+		if i, ok := index[episode.ID]; ok {
+			merged.Episodes[i] = MergeEpisode(merged.Episodes[i], episode)
+			continue
+		}
+
+		index[episode.ID] = len(merged.Episodes)
+		merged.Episodes = append(merged.Episodes, MergeEpisode(nil, episode))
+	}
+
+	return &merged
+}
+
+// MergeEpisode returns the existing episode updated with the incoming one,
+// see Merge. The parent anime is never copied.
+func MergeEpisode(existing, incoming *Episode) *Episode {
+	if existing == nil {
+		existing = &Episode{}
+	}
+	if incoming == nil {
+		incoming = &Episode{}
+	}
+
+	merged := *existing
+	merged.Anime = nil
+	merged.Previous = nil
+	merged.Next = nil
+	merged.Subtitles = nil
+	merged.ID = prefer(existing.ID, incoming.ID)
+	merged.Slug = prefer(existing.Slug, incoming.Slug)
+	merged.Episode = prefer(existing.Episode, incoming.Episode)
+	merged.Number = prefer(existing.Number, incoming.Number)
+	merged.Range = prefer(existing.Range, incoming.Range)
+	merged.Kind = prefer(existing.Kind, incoming.Kind)
+	merged.CreatedAt = prefer(existing.CreatedAt, incoming.CreatedAt)
+	merged.ThumbnailURL = prefer(existing.ThumbnailURL, incoming.ThumbnailURL)
+
+	switch {
+	case len(incoming.Watches) == 0:
+	case len(existing.Watches) == 0 || isNewer(incoming.WatchesFetchedAt, existing.WatchesFetchedAt):
+		merged.Watches = mergeWatches(existing.Watches, incoming.Watches)
+	default:
+		merged.Watches = mergeWatchState(existing.Watches, incoming.Watches)
+	}
+	// a fetch without any watch still counts, so it is not retried at once
+	merged.WatchesFetchedAt = latest(existing.WatchesFetchedAt, incoming.WatchesFetchedAt)
+	merged.WatchesFailedAt = latest(existing.WatchesFailedAt, incoming.WatchesFailedAt)
+
+	if isNewer(incoming.DownloadsFetchedAt, existing.DownloadsFetchedAt) || (incoming.DownloadsFetchedAt == nil && len(incoming.Downloads) > 0) {
+		merged.Downloads = incoming.Downloads
+	}
+	merged.DownloadsFetchedAt = latest(existing.DownloadsFetchedAt, incoming.DownloadsFetchedAt)
+
+	return &merged
+}
+
+// mergeWatches returns the incoming watches, keeping the health and the
+// resolved sources of the existing ones with the same stream URL.
+func mergeWatches(existing, incoming []*Watch) []*Watch {
+	known := map[string]*Watch{}
+	for _, watch := range existing {
+		known[watch.StreamURL] = watch
+	}
+
+	var result []*Watch
+	for _, watch := range incoming {
+		merged := *watch
+		if old, ok := known[watch.StreamURL]; ok {
+			merged.Health = prefer(old.Health, watch.Health)
+			merged.LastVerifiedAt = latest(old.LastVerifiedAt, watch.LastVerifiedAt)
+			// watches already resolved are not resolved again on every scrape
+			if len(watch.Sources) == 0 && len(watch.Subtitles) == 0 {
+				merged.Sources = old.Sources
+				merged.Subtitles = old.Subtitles
+			}
+		}
+		result = append(result, &merged)
+	}
+
+	return result
+}
+
+// mergeWatchState returns the existing watches with the health and the broken
+// report of the incoming ones with the same stream URL, it is used for the
+// checks and reports which do not scrape the watches again.
+func mergeWatchState(existing, incoming []*Watch) []*Watch {
+	state := map[string]*Watch{}
+	for _, watch := range incoming {
+		state[watch.StreamURL] = watch
+	}
+
+	var result []*Watch
+	for _, watch := range existing {
+		merged := *watch
+		if update, ok := state[watch.StreamURL]; ok {
+			if update.Health != nil && (merged.Health == nil || !isNewer(merged.Health.CheckedAt, update.Health.CheckedAt)) {
+				merged.Health = update.Health
+			}
+			merged.LastVerifiedAt = latest(merged.LastVerifiedAt, update.LastVerifiedAt)
+			merged.BrokenAt = latest(merged.BrokenAt, update.BrokenAt)
+		}
+		result = append(result, &merged)
+	}
+
+	return result
+}
+
+// prefer returns incoming unless it is the zero value.
+func prefer[T comparable](existing, incoming T) T {
+	var zero T
+	if incoming != zero {
+		return incoming
+	}
+
+	return existing
+}
+
+func union(existing, incoming []string) []string {
+	result := existing
+	found := map[string]bool{}
+	for _, item := range existing {
+		found[item] = true
+	}
+
+	for _, item := range incoming {
+		if found[item] {
+			continue
+		}
+
+		found[item] = true
+		result = append(result[:len(result):len(result)], item)
+	}
+
+	return result
+}
+
+func isNewer(t, than *time.Time) bool {
+	return t != nil && (than == nil || t.After(*than))
+}
+
+func latest(t, other *time.Time) *time.Time {
+	if isNewer(other, t) {
+		return other
+	}
+
+	return t
+}
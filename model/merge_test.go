@@ -0,0 +1,229 @@
+package model
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// randomAnime is an anime with a few episodes and watches, the ids are drawn
+// from a small range so two of them often share episodes.
+type randomAnime struct {
+	*Anime
+}
+
+func (randomAnime) Generate(r *rand.Rand, size int) reflect.Value {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	randomTime := func() *time.Time {
+		if r.Intn(4) == 0 {
+			return nil
+		}
+		t := base.Add(time.Hour * time.Duration(r.Intn(100)))
+		return &t
+	}
+	randomString := func(prefix string) string {
+		if r.Intn(3) == 0 {
+			return ""
+		}
+		return prefix + strconv.Itoa(r.Intn(5))
+	}
+
+	anime := &Anime{
+		ID:                1,
+		Title:             randomString("title "),
+		Slug:              randomString("slug-"),
+		Score:             float64(r.Intn(3)),
+		CoverURL:          randomString("https://cover/"),
+		MetadataFetchedAt: randomTime(),
+		EpisodesFetchedAt: randomTime(),
+	}
+	for i := r.Intn(3); i > 0; i-- {
+		anime.AlternativeTitles = append(anime.AlternativeTitles, randomString("alt "))
+	}
+
+	ids := r.Perm(6)[:r.Intn(6)]
+	for _, id := range ids {
+		episode := &Episode{
+			ID:               id + 1,
+			Slug:             randomString("episode-"),
+			CreatedAt:        randomTime(),
+			WatchesFetchedAt: randomTime(),
+		}
+		for i := r.Intn(3); i > 0; i-- {
+			episode.Watches = append(episode.Watches, &Watch{
+				ID:        i,
+				StreamURL: randomString("https://stream/") + strconv.Itoa(i),
+			})
+		}
+		anime.Episodes = append(anime.Episodes, episode)
+	}
+
+	return reflect.ValueOf(randomAnime{anime})
+}
+
+func TestMergeEmptyIsIdentity(t *testing.T) {
+	identity := func(a randomAnime) bool {
+		return reflect.DeepEqual(Merge(a.Anime, &Anime{}), a.Anime)
+	}
+
+	if err := quick.Check(identity, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeKeepsEpisodesUnique(t *testing.T) {
+	unique := func(a, b randomAnime) bool {
+		want := map[int]bool{}
+		for _, episode := range append(a.Episodes, b.Episodes...) {
+			want[episode.ID] = true
+		}
+
+		got := map[int]bool{}
+		for _, episode := range Merge(a.Anime, b.Anime).Episodes {
+			if got[episode.ID] {
+				return false
+			}
+			got[episode.ID] = true
+		}
+
+		return reflect.DeepEqual(got, want)
+	}
+
+	if err := quick.Check(unique, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeNewerWatchesWin(t *testing.T) {
+	streamURLs := func(watches []*Watch) []string {
+		var urls []string
+		for _, watch := range watches {
+			urls = append(urls, watch.StreamURL)
+		}
+		return urls
+	}
+
+	newer := func(a, b randomAnime) bool {
+		incoming := map[int]*Episode{}
+		for _, episode := range b.Episodes {
+			incoming[episode.ID] = episode
+		}
+
+		merged := Merge(a.Anime, b.Anime)
+		for i, existing := range a.Episodes {
+			got := streamURLs(merged.Episodes[i].Watches)
+			in, ok := incoming[existing.ID]
+			switch {
+			case !ok || len(in.Watches) == 0:
+				if !reflect.DeepEqual(got, streamURLs(existing.Watches)) {
+					return false
+				}
+			case len(existing.Watches) == 0 || isNewer(in.WatchesFetchedAt, existing.WatchesFetchedAt):
+				if !reflect.DeepEqual(got, streamURLs(in.Watches)) {
+					return false
+				}
+			default:
+				if !reflect.DeepEqual(got, streamURLs(existing.Watches)) {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	if err := quick.Check(newer, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeWatchState(t *testing.T) {
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	checkedAt := fetchedAt.Add(time.Hour)
+	existing := &Anime{ID: 1, Episodes: []*Episode{{
+		ID:               1,
+		WatchesFetchedAt: &fetchedAt,
+		Watches: []*Watch{
+			{ID: 1, StreamURL: "https://a", Source: "A"},
+			{ID: 2, StreamURL: "https://b", Source: "B"},
+		},
+	}}}
+
+	merged := Merge(existing, &Anime{Episodes: []*Episode{{
+		ID: 1,
+		Watches: []*Watch{
+			{StreamURL: "https://b", BrokenAt: &checkedAt, Health: &WatchHealth{StatusCode: 404, CheckedAt: &checkedAt}},
+			{StreamURL: "https://unknown", BrokenAt: &checkedAt},
+		},
+	}}})
+
+	watches := merged.Episodes[0].Watches
+	if len(watches) != 2 || watches[0].BrokenAt != nil || watches[1].Source != "B" {
+		t.Fatalf("state update changed the watches: %+v", watches)
+	}
+	if watches[1].BrokenAt == nil || watches[1].Health == nil || watches[1].Health.StatusCode != 404 {
+		t.Errorf("state not applied: %+v", watches[1])
+	}
+	if existing.Episodes[0].Watches[1].BrokenAt != nil {
+		t.Error("existing anime was modified")
+	}
+}
+
+func TestMergeKeepsResolvedSources(t *testing.T) {
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	refetchedAt := fetchedAt.Add(time.Hour)
+	source := &Source{URL: "https://media/a.mp4", Type: SourceTypeMP4}
+	existing := &Anime{ID: 1, Episodes: []*Episode{{
+		ID:               1,
+		WatchesFetchedAt: &fetchedAt,
+		Watches:          []*Watch{{ID: 1, StreamURL: "https://a", Sources: []*Source{source}}},
+	}}}
+
+	merged := Merge(existing, &Anime{Episodes: []*Episode{{
+		ID:               1,
+		WatchesFetchedAt: &refetchedAt,
+		Watches: []*Watch{
+			{ID: 1, StreamURL: "https://a"},
+			{ID: 2, StreamURL: "https://b"},
+		},
+	}}})
+
+	watches := merged.Episodes[0].Watches
+	if len(watches) != 2 || len(watches[0].Sources) != 1 || watches[0].Sources[0] != source {
+		t.Errorf("resolved sources lost: %+v", watches[0])
+	}
+	if len(watches[1].Sources) != 0 {
+		t.Errorf("new watch got sources: %+v", watches[1])
+	}
+}
+
+func TestMergeDownloads(t *testing.T) {
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	refetchedAt := fetchedAt.Add(time.Hour)
+	downloads := []*Download{{Format: "mkv", Quality: "720p", URL: "https://gofile.io/d/a"}}
+
+	tests := []struct {
+		name     string
+		existing *Episode
+		incoming *Episode
+		want     int
+	}{
+		{"first fetch without downloads", &Episode{ID: 1}, &Episode{ID: 1, DownloadsFetchedAt: &fetchedAt}, 0},
+		{"newer fetch removes them", &Episode{ID: 1, Downloads: downloads, DownloadsFetchedAt: &fetchedAt}, &Episode{ID: 1, DownloadsFetchedAt: &refetchedAt}, 0},
+		{"older fetch is ignored", &Episode{ID: 1, DownloadsFetchedAt: &refetchedAt}, &Episode{ID: 1, Downloads: downloads, DownloadsFetchedAt: &fetchedAt}, 0},
+		{"no fetch time keeps them", &Episode{ID: 1, Downloads: downloads, DownloadsFetchedAt: &fetchedAt}, &Episode{ID: 1}, 1},
+	}
+
+	for _, test := range tests {
+		merged := MergeEpisode(test.existing, test.incoming)
+		if len(merged.Downloads) != test.want {
+			t.Errorf("%s: got %d downloads, want %d", test.name, len(merged.Downloads), test.want)
+		}
+		if merged.DownloadsFetchedAt == nil {
+			t.Errorf("%s: fetch time lost", test.name)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"animenya.site/data"
+	"animenya.site/db"
+)
+
+// AnimeSchemaVersion is the version of the stored anime records, bump it and
+// register a migration in animeMigrations whenever the stored shape changes.
+const AnimeSchemaVersion = 4
+
+// animeMigrations upgrades a raw record from the version used as key to the
+// next version.
+var animeMigrations = map[int]func(record map[string]any) error{
+	0: migrateAnimeToV1,
+	1: migrateAnimeToV2,
+	2: migrateAnimeToV3,
+	3: migrateAnimeToV4,
+}
+
+// migrateAnimeToV1 moves the metadata scraped as plain strings into the raw
+// fields so they can be normalized, and parses the episode labels.
+func migrateAnimeToV1(record map[string]any) error {
+	fields := map[string]string{
+		"duration":       "duration_raw",
+		"score":          "score_raw",
+		"status":         "status_raw",
+		"total_episodes": "total_episodes_raw",
+		"release_date":   "release_date_raw",
+	}
+	for field, rawField := range fields {
+		value, ok := record[field].(string)
+		if !ok {
+			continue
+		}
+
+		// records saved after the raw fields were added already hold the
+		// scraped string there and a parsed value in the field
+		if _, ok := record[rawField]; ok {
+			continue
+		}
+
+		delete(record, field)
+		record[rawField] = value
+	}
+
+	episodes, _ := record["episodes"].([]any)
+	for _, _episode := range episodes {
+		episode, ok := _episode.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		label, _ := episode["episode"].(string)
+		var parsed Episode
+		parsed.ParseEpisode(label)
+
+		episode["kind"] = parsed.Kind
+		if parsed.Number != nil {
+			episode["number"] = *parsed.Number
+		}
+		if parsed.Range != nil {
+			episode["range"] = parsed.Range
+		}
+	}
+
+	return nil
+}
+
+// migrateAnimeToV2 replaces the single cache expiry, which was set 3 days
+// after the last fetch, with the per section fetch times.
+func migrateAnimeToV2(record map[string]any) error {
+	cacheExpireAt, ok := record["cache_expire_at"].(string)
+	delete(record, "cache_expire_at")
+	if !ok {
+		return nil
+	}
+
+	expireAt, err := time.Parse(time.RFC3339Nano, cacheExpireAt)
+	if err != nil {
+		return nil
+	}
+
+	fetchedAt := expireAt.Add(-time.Hour * 24 * 3)
+	record["metadata_fetched_at"] = fetchedAt
+	record["episodes_fetched_at"] = fetchedAt
+	return nil
+}
+
+// migrateAnimeToV3 fills the server, quality, format, language and
+// translation of the stored watches from their player title and sources.
+func migrateAnimeToV3(record map[string]any) error {
+	episodes, _ := record["episodes"].([]any)
+	for _, _episode := range episodes {
+		episode, ok := _episode.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		watches, _ := episode["watches"].([]any)
+		for _, _watch := range watches {
+			watch, ok := _watch.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			content, err := json.Marshal(watch)
+			if err != nil {
+				return err
+			}
+
+			var parsed Watch
+			if err := json.Unmarshal(content, &parsed); err != nil {
+				return err
+			}
+			parsed.Normalize()
+
+			watch["server"] = parsed.Server
+			watch["quality"] = parsed.Quality
+			watch["format"] = parsed.Format
+			watch["language"] = parsed.Language
+			watch["translation"] = parsed.Translation
+		}
+	}
+
+	return nil
+}
+
+// migrateAnimeToV4 clears the covers, which were set to an episode screenshot
+// before the episodes had their own thumbnail. The oldest records have no
+// episode thumbnail to compare the cover with, so every cover is cleared along
+// with its preview, and the metadata is marked stale so the next read fetches
+// the real cover.
+func migrateAnimeToV4(record map[string]any) error {
+	if coverURL, _ := record["cover_url"].(string); coverURL == "" {
+		return nil
+	}
+
+	record["cover_url"] = ""
+	delete(record, "cover_blurhash")
+	delete(record, "cover_color")
+	delete(record, "cover_preview_of")
+	delete(record, "metadata_fetched_at")
+	return nil
+}
+
+// decode unmarshals a stored record into the anime, running every migration
+// needed to bring it to AnimeSchemaVersion. It reports whether the record was
+// migrated and differs from the stored one.
+func (a *Anime) decode(content []byte) (bool, error) {
+	var record map[string]any
+	if err := json.Unmarshal(content, &record); err != nil {
+		return false, err
+	}
+
+	var version int
+	if _version, ok := record["schema_version"].(float64); ok {
+		version = int(_version)
+	}
+
+	if version > AnimeSchemaVersion {
+		return false, fmt.Errorf("UNKNOWN_SCHEMA_VERSION")
+	}
+
+	migrated := version < AnimeSchemaVersion
+	for ; version < AnimeSchemaVersion; version++ {
+		migration, ok := animeMigrations[version]
+		if !ok {
+			return false, fmt.Errorf("MIGRATION_NOT_FOUND")
+		}
+
+		if err := migration(record); err != nil {
+			return false, err
+		}
+	}
+
+	coerced := coerceNumbers(record)
+	if migrated || coerced {
+		record["schema_version"] = version
+		_content, err := json.Marshal(record)
+		if err != nil {
+			return false, err
+		}
+		content = _content
+	}
+
+	if err := json.Unmarshal(content, a); err != nil {
+		return false, err
+	}
+
+	if migrated || coerced {
+		a.Normalize()
+	}
+
+	return migrated || coerced, nil
+}
+
+// coerceNumbers moves the score and the total episodes into their raw fields
+// when they are still stored as the scraped strings, which some records do
+// regardless of their schema version, so Normalize parses them. A raw field
+// already set is kept. It reports whether the record changed.
+func coerceNumbers(record map[string]any) bool {
+	var changed bool
+	if score, ok := record["score"].(string); ok {
+		changed = true
+		delete(record, "score")
+		if _, ok := record["score_raw"]; !ok {
+			record["score_raw"] = score
+		}
+	}
+
+	if totalEpisodes, ok := record["total_episodes"].(string); ok {
+		changed = true
+		delete(record, "total_episodes")
+		if _, ok := record["total_episodes_raw"]; !ok {
+			record["total_episodes_raw"] = totalEpisodes
+		}
+	}
+
+	return changed
+}
+
+// MigrateAnime upgrades every stored anime record to AnimeSchemaVersion and
+// returns the number of migrated records.
+func MigrateAnime(db db.DBInterface) (int, error) {
+	ids, err := db.List(data.DBAnime)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for _, id := range ids {
+		animeID, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+
+		content, err := db.Get(data.DBAnime, &id)
+		if err != nil {
+			return total, err
+		}
+
+		anime := Anime{ID: animeID}
+		migrated, err := anime.decode(*content)
+		if err != nil {
+			return total, fmt.Errorf("anime %s: %w", id, err)
+		}
+		if !migrated {
+			continue
+		}
+
+		if err := anime.Save(db); err != nil {
+			return total, err
+		}
+		total++
+	}
+
+	return total, nil
+}
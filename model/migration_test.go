@@ -0,0 +1,203 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeNumberShapes(t *testing.T) {
+	tests := []struct {
+		name          string
+		record        string
+		score         float64
+		totalEpisodes int
+	}{
+		{
+			name:          "numbers",
+			record:        `{"id":1,"schema_version":4,"score":8.5,"total_episodes":12}`,
+			score:         8.5,
+			totalEpisodes: 12,
+		},
+		{
+			name:          "strings",
+			record:        `{"id":1,"schema_version":4,"score":"8.5","total_episodes":"12"}`,
+			score:         8.5,
+			totalEpisodes: 12,
+		},
+		{
+			name:          "strings with raw",
+			record:        `{"id":1,"schema_version":4,"score":"8.5","score_raw":"7,9","total_episodes":"?","total_episodes_raw":"24"}`,
+			score:         7.9,
+			totalEpisodes: 24,
+		},
+		{
+			name:   "unknown",
+			record: `{"id":1,"schema_version":4,"score":"N/A","total_episodes":"?"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var anime Anime
+			if _, err := anime.decode([]byte(test.record)); err != nil {
+				t.Fatal(err)
+			}
+
+			if anime.Score != test.score {
+				t.Errorf("score = %v, want %v", anime.Score, test.score)
+			}
+
+			var totalEpisodes int
+			if anime.TotalEpisodes != nil {
+				totalEpisodes = *anime.TotalEpisodes
+			}
+			if totalEpisodes != test.totalEpisodes {
+				t.Errorf("total episodes = %v, want %v", totalEpisodes, test.totalEpisodes)
+			}
+		})
+	}
+}
+
+func TestAnimeMigrations(t *testing.T) {
+	tests := []struct {
+		name      string
+		migration func(record map[string]any) error
+		record    string
+		want      string
+	}{
+		{
+			name:      "v1 moves scraped strings to raw fields",
+			migration: migrateAnimeToV1,
+			record:    `{"id":1,"score":"8.5","status":"Currently Airing","duration":"24 min.","total_episodes":"12","release_date":"Jul 2, 2024"}`,
+			want:      `{"id":1,"score_raw":"8.5","status_raw":"Currently Airing","duration_raw":"24 min.","total_episodes_raw":"12","release_date_raw":"Jul 2, 2024"}`,
+		},
+		{
+			name:      "v1 keeps existing raw fields",
+			migration: migrateAnimeToV1,
+			record:    `{"id":1,"score":8.5,"score_raw":"8.5","status":"airing","status_raw":"Currently Airing","release_date":"2024-07-02","release_date_raw":"Jul 2, 2024"}`,
+			want:      `{"id":1,"score":8.5,"score_raw":"8.5","status":"airing","status_raw":"Currently Airing","release_date":"2024-07-02","release_date_raw":"Jul 2, 2024"}`,
+		},
+		{
+			name:      "v1 parses episode labels",
+			migration: migrateAnimeToV1,
+			record:    `{"id":1,"episodes":[{"id":10,"episode":"12"},{"id":11,"episode":"1-12 Batch"}]}`,
+			want:      `{"id":1,"episodes":[{"id":10,"episode":"12","kind":"episode","number":12},{"id":11,"episode":"1-12 Batch","kind":"batch","range":{"from":1,"to":12}}]}`,
+		},
+		{
+			name:      "v2 derives fetch times from the cache expiry",
+			migration: migrateAnimeToV2,
+			record:    `{"id":1,"cache_expire_at":"2024-07-05T10:00:00Z"}`,
+			want:      `{"id":1,"metadata_fetched_at":"2024-07-02T10:00:00Z","episodes_fetched_at":"2024-07-02T10:00:00Z"}`,
+		},
+		{
+			name:      "v2 drops an unreadable cache expiry",
+			migration: migrateAnimeToV2,
+			record:    `{"id":1,"cache_expire_at":"soon"}`,
+			want:      `{"id":1}`,
+		},
+		{
+			name:      "v3 parses the stored watches",
+			migration: migrateAnimeToV3,
+			record:    `{"id":1,"episodes":[{"id":10,"watches":[{"id":1,"source":"Blogger 720p","stream_url":"https://www.blogger.com/video.g?token=x","host":"www.blogger.com"}]}]}`,
+			want:      `{"id":1,"episodes":[{"id":10,"watches":[{"id":1,"source":"Blogger 720p","stream_url":"https://www.blogger.com/video.g?token=x","host":"www.blogger.com","server":"Blogger","quality":"720p","format":"embed","language":"id","translation":"sub"}]}]}`,
+		},
+		{
+			name:      "v4 clears a cover set to an episode thumbnail",
+			migration: migrateAnimeToV4,
+			record:    `{"id":1,"cover_url":"https://b/2.jpg","cover_blurhash":"L","cover_color":"#000000","cover_preview_of":"https://b/2.jpg","metadata_fetched_at":"2024-07-02T10:00:00Z","episodes":[{"id":10,"thumbnail_url":"https://b/1.jpg"},{"id":11,"thumbnail_url":"https://b/2.jpg"}]}`,
+			want:      `{"id":1,"cover_url":"","episodes":[{"id":10,"thumbnail_url":"https://b/1.jpg"},{"id":11,"thumbnail_url":"https://b/2.jpg"}]}`,
+		},
+		{
+			name:      "v4 clears a cover without any episode thumbnail",
+			migration: migrateAnimeToV4,
+			record:    `{"id":1,"cover_url":"https://b/cover.jpg","cover_color":"#000000","metadata_fetched_at":"2024-07-02T10:00:00Z","episodes":[{"id":10}]}`,
+			want:      `{"id":1,"cover_url":"","episodes":[{"id":10}]}`,
+		},
+		{
+			name:      "v4 keeps a record without cover",
+			migration: migrateAnimeToV4,
+			record:    `{"id":1,"cover_url":"","metadata_fetched_at":"2024-07-02T10:00:00Z"}`,
+			want:      `{"id":1,"cover_url":"","metadata_fetched_at":"2024-07-02T10:00:00Z"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(test.record), &record); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := test.migration(record); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := json.Marshal(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got, want any
+			if err := json.Unmarshal(content, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s\nwant %s", content, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyRecord(t *testing.T) {
+	// a record saved before the schema version, as the first release stored
+	// it: the cover comes from the og:image of an episode post and the
+	// episodes have no thumbnail
+	record := `{
+		"id": 2604,
+		"post_id": 38201,
+		"title": "Karasu wa Aruji wo Erabanai ",
+		"slug": "karasu-wa-aruji-wo-erabanai",
+		"score": "7.41",
+		"status": "Currently Airing",
+		"cover_url": "https://source.example/wp-content/uploads/2024/09/Karasu-wa-Aruji-wo-Erabanai-Episode-19.jpg",
+		"total_episodes": "20",
+		"episodes": [
+			{"id": 38474, "slug": "karasu-wa-aruji-wo-erabanai-episode-19", "episode": "19", "created_at": "2024-09-15T03:38:13Z",
+				"watches": [{"id": 1, "source": "Nakama 720p", "stream_url": "https://nakama.example/e/abc"}]},
+			{"id": 38201, "slug": "karasu-wa-aruji-wo-erabanai-episode-18", "episode": "18", "created_at": "2024-09-08T03:30:02Z"}
+		],
+		"cache_expire_at": "2024-09-18T03:38:15.123456789Z"
+	}`
+
+	var anime Anime
+	migrated, err := anime.decode([]byte(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migrated {
+		t.Error("legacy record is not migrated")
+	}
+	if anime.SchemaVersion != AnimeSchemaVersion {
+		t.Errorf("schema version %d, want %d", anime.SchemaVersion, AnimeSchemaVersion)
+	}
+	if anime.CoverURL != "" {
+		t.Errorf("cover %q is kept", anime.CoverURL)
+	}
+	if !anime.IsMetadataStale() {
+		t.Error("metadata is not stale, the real cover would not be fetched")
+	}
+	if anime.EpisodesFetchedAt == nil {
+		t.Error("episodes fetch time is not derived from the cache expiry")
+	}
+	if anime.Score != 7.41 || anime.TotalEpisodes == nil || *anime.TotalEpisodes != 20 {
+		t.Errorf("score %v and total episodes %v are not parsed", anime.Score, anime.TotalEpisodes)
+	}
+	if len(anime.Episodes) != 2 || anime.Episodes[0].Kind != EpisodeKindEpisode || anime.Episodes[0].Watches[0].Quality != "720p" {
+		t.Errorf("episodes are not migrated: %+v", anime.Episodes)
+	}
+}
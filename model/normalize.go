@@ -0,0 +1,146 @@
+package model
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AnimeStatus string
+
+const (
+	AnimeStatusAiring   AnimeStatus = "airing"
+	AnimeStatusFinished AnimeStatus = "finished"
+	AnimeStatusUpcoming AnimeStatus = "upcoming"
+)
+
+var (
+	durationHourRegex   = regexp.MustCompile(`(?i)(\d+)\s*(?:hr|hour|jam|h\b)`)
+	durationMinuteRegex = regexp.MustCompile(`(?i)(\d+)\s*(?:min|menit|m\b)`)
+	releaseDateLayouts  = []string{
+		"2006-01-02",
+		"Jan 2, 2006",
+		"January 2, 2006",
+		"2 Jan 2006",
+		"2 January 2006",
+		"Jan 2006",
+		"2006",
+	}
+)
+
+// Normalize fills the typed metadata fields from the raw strings scraped from
+// the source, and the parsed fields of every watch. Fields without a raw value
+// are left untouched.
+func (a *Anime) Normalize() {
+	if a.TitleRaw == nil && a.Title != strings.TrimSpace(a.Title) {
+		titleRaw := a.Title
+		a.TitleRaw = &titleRaw
+	}
+	a.Title = strings.TrimSpace(a.Title)
+
+	if a.ScoreRaw != nil {
+		a.Score = ParseScore(*a.ScoreRaw)
+	}
+
+	if a.DurationRaw != nil {
+		a.DurationMinutes = ParseDurationMinutes(*a.DurationRaw)
+	}
+
+	if a.StatusRaw != nil {
+		a.Status = ParseAnimeStatus(*a.StatusRaw)
+	}
+
+	if a.ReleaseDateRaw != nil {
+		a.ReleaseDate = ParseReleaseDate(*a.ReleaseDateRaw)
+	}
+
+	if a.TotalEpisodeRaw != nil {
+		a.TotalEpisodes = ParseTotalEpisodes(*a.TotalEpisodeRaw)
+	}
+
+	for _, episode := range a.Episodes {
+		for _, watch := range episode.Watches {
+			watch.Normalize()
+		}
+	}
+}
+
+// StripRaw removes the raw source strings, they are only useful for debugging.
+func (a *Anime) StripRaw() {
+	a.TitleRaw = nil
+	a.ScoreRaw = nil
+	a.DurationRaw = nil
+	a.StatusRaw = nil
+	a.ReleaseDateRaw = nil
+	a.TotalEpisodeRaw = nil
+	a.CoverPreviewOf = ""
+}
+
+func ParseScore(str string) float64 {
+	score, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(str), ",", "."), 64)
+	if err != nil {
+		return 0
+	}
+
+	return score
+}
+
+// ParseDurationMinutes parses durations like "24 min.", "1 hr. 30 min." or
+// "23 min. per ep." into minutes.
+func ParseDurationMinutes(str string) int {
+	var minutes int
+	if match := durationHourRegex.FindStringSubmatch(str); match != nil {
+		hours, _ := strconv.Atoi(match[1])
+		minutes += hours * 60
+	}
+
+	if match := durationMinuteRegex.FindStringSubmatch(str); match != nil {
+		_minutes, _ := strconv.Atoi(match[1])
+		minutes += _minutes
+	}
+
+	return minutes
+}
+
+func ParseAnimeStatus(str string) AnimeStatus {
+	str = strings.ToLower(strings.TrimSpace(str))
+	// "Finished Airing" and "Not yet aired" contain the airing keywords too,
+	// so they are matched first
+	switch {
+	case strings.Contains(str, "upcoming"), strings.Contains(str, "not yet"):
+		return AnimeStatusUpcoming
+	case strings.Contains(str, "complete"), strings.Contains(str, "finished"), strings.Contains(str, "tamat"):
+		return AnimeStatusFinished
+	case strings.Contains(str, "ongoing"), strings.Contains(str, "airing"), strings.Contains(str, "currently"):
+		return AnimeStatusAiring
+	}
+
+	return ""
+}
+
+// ParseReleaseDate parses the release date into an ISO date (2006-01-02).
+// Ranges like "Jul 2, 2024 to ?" use their first date.
+func ParseReleaseDate(str string) *string {
+	str = strings.TrimSpace(strings.SplitN(str, " to ", 2)[0])
+	for _, layout := range releaseDateLayouts {
+		date, err := time.Parse(layout, str)
+		if err != nil {
+			continue
+		}
+
+		releaseDate := date.Format("2006-01-02")
+		return &releaseDate
+	}
+
+	return nil
+}
+
+func ParseTotalEpisodes(str string) *int {
+	totalEpisodes, err := strconv.Atoi(strings.TrimSpace(str))
+	if err != nil || totalEpisodes < 1 {
+		return nil
+	}
+
+	return &totalEpisodes
+}
@@ -0,0 +1,44 @@
+package model
+
+import "testing"
+
+func TestParseAnimeStatus(t *testing.T) {
+	tests := map[string]AnimeStatus{
+		"Currently Airing": AnimeStatusAiring,
+		"Ongoing":          AnimeStatusAiring,
+		"Finished Airing":  AnimeStatusFinished,
+		"Completed":        AnimeStatusFinished,
+		"Tamat":            AnimeStatusFinished,
+		"Not yet aired":    AnimeStatusUpcoming,
+		"Not yet airing":   AnimeStatusUpcoming,
+		"Upcoming":         AnimeStatusUpcoming,
+		"":                 "",
+		"Hiatus":           "",
+	}
+
+	for str, want := range tests {
+		if got := ParseAnimeStatus(str); got != want {
+			t.Errorf("ParseAnimeStatus(%q) = %q, want %q", str, got, want)
+		}
+	}
+}
+
+func TestParseDurationMinutes(t *testing.T) {
+	tests := map[string]int{
+		"24 min.":         24,
+		"23 min. per ep.": 23,
+		"1 hr. 30 min.":   90,
+		"1h 30m":          90,
+		"2 hr.":           120,
+		"1 jam 5 menit":   65,
+		"45m":             45,
+		"":                0,
+		"Unknown":         0,
+	}
+
+	for str, want := range tests {
+		if got := ParseDurationMinutes(str); got != want {
+			t.Errorf("ParseDurationMinutes(%q) = %d, want %d", str, got, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"animenya.site/data"
+	"animenya.site/db"
+)
+
+// WatchReportThreshold is the number of distinct clients reporting a watch
+// before its episode watches are scraped again.
+const WatchReportThreshold = 3
+
+// maxReports caps the reports kept on a watch report, the oldest handled ones
+// are dropped first.
+const maxReports = 20
+
+type WatchReportStatus string
+
+const (
+	WatchReportStatusOpen      WatchReportStatus = "open"
+	WatchReportStatusRescraped WatchReportStatus = "rescraped"
+	WatchReportStatusDismissed WatchReportStatus = "dismissed"
+)
+
+// WatchReport collects the client reports of a dead watch.
+type WatchReport struct {
+	ID        string            `json:"id"`
+	AnimeID   int               `json:"anime_id"`
+	EpisodeID int               `json:"episode_id"`
+	WatchID   int               `json:"watch_id"`
+	Source    string            `json:"source"`
+	StreamURL string            `json:"stream_url"`
+	Status    WatchReportStatus `json:"status"`
+	Reports   []*Report         `json:"reports"`
+	// RescrapedAt is when the threshold was reached and a new scrape queued
+	RescrapedAt *time.Time `json:"rescraped_at,omitempty"`
+	DismissedAt *time.Time `json:"dismissed_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+type Report struct {
+	// Client is a hash of the reporting client, never its address
+	Client    string     `json:"client"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+func WatchReportID(animeID int, episodeID int, watchID int) string {
+	return fmt.Sprintf("%d-%d-%d", animeID, episodeID, watchID)
+}
+
+func (r *WatchReport) Get(db db.DBInterface) error {
+	if r.ID == "" {
+		return fmt.Errorf("ID_IS_EMPTY")
+	}
+
+	content, err := db.Get(data.DBReport, &r.ID)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(*content, r)
+}
+
+func (r *WatchReport) Save(db db.DBInterface) error {
+	now := time.Now()
+	r.UpdatedAt = &now
+	r.prune()
+
+	content, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return db.Save(data.DBReport, &r.ID, &content)
+}
+
+// PendingClients returns the number of distinct clients that reported the
+// watch since it was last scraped again or dismissed.
+func (r *WatchReport) PendingClients() int {
+	since := latest(r.RescrapedAt, r.DismissedAt)
+	clients := map[string]bool{}
+	for _, report := range r.Reports {
+		if since != nil && report.CreatedAt != nil && !report.CreatedAt.After(*since) {
+			continue
+		}
+		clients[report.Client] = true
+	}
+
+	return len(clients)
+}
+
+// prune keeps the latest pending report of every client, they are all that
+// PendingClients counts, and the most recent handled ones up to maxReports.
+func (r *WatchReport) prune() {
+	since := latest(r.RescrapedAt, r.DismissedAt)
+	seen := map[string]bool{}
+	var kept []*Report
+	for i := len(r.Reports) - 1; i >= 0 && len(kept) < maxReports; i-- {
+		report := r.Reports[i]
+		if since == nil || report.CreatedAt == nil || report.CreatedAt.After(*since) {
+			if seen[report.Client] {
+				continue
+			}
+			seen[report.Client] = true
+		}
+
+		kept = append(kept, report)
+	}
+
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	r.Reports = kept
+}
+
+// ListWatchReports returns every stored report, most recently updated first.
+func ListWatchReports(db db.DBInterface) ([]*WatchReport, error) {
+	ids, err := db.List(data.DBReport)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*WatchReport
+	for _, id := range ids {
+		report := WatchReport{ID: id}
+		if err := report.Get(db); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &report)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UpdatedAt == nil || result[j].UpdatedAt == nil {
+			return result[j].UpdatedAt == nil && result[i].UpdatedAt != nil
+		}
+		return result[i].UpdatedAt.After(*result[j].UpdatedAt)
+	})
+
+	return result, nil
+}
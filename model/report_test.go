@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWatchReportPrune(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	at := func(minutes int) *time.Time {
+		t := start.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+
+	// a long history is capped, the pending reports are the newest so they
+	// are all kept
+	var long []*Report
+	var longClients []string
+	for i := 0; i < maxReports*2; i++ {
+		long = append(long, &Report{Client: fmt.Sprint(i), CreatedAt: at(i)})
+		if i >= maxReports+2 {
+			longClients = append(longClients, fmt.Sprint(i))
+		}
+	}
+	long = append(long, &Report{Client: "x", CreatedAt: at(maxReports * 2)}, &Report{Client: "y", CreatedAt: at(maxReports*2 + 1)})
+
+	tests := []struct {
+		name        string
+		report      WatchReport
+		wantClients []string
+		pending     int
+	}{
+		{
+			name: "a client is kept once while pending",
+			report: WatchReport{Reports: []*Report{
+				{Client: "a", CreatedAt: at(1)},
+				{Client: "a", CreatedAt: at(2)},
+				{Client: "b", CreatedAt: at(3)},
+				{Client: "a", CreatedAt: at(4)},
+			}},
+			wantClients: []string{"b", "a"},
+			pending:     2,
+		},
+		{
+			name: "handled reports are kept as they are",
+			report: WatchReport{RescrapedAt: at(3), Reports: []*Report{
+				{Client: "a", CreatedAt: at(1)},
+				{Client: "a", CreatedAt: at(2)},
+				{Client: "a", CreatedAt: at(4)},
+				{Client: "a", CreatedAt: at(5)},
+			}},
+			wantClients: []string{"a", "a", "a"},
+			pending:     1,
+		},
+		{
+			name:        "long history",
+			report:      WatchReport{DismissedAt: at(maxReports*2 - 1), Reports: long},
+			wantClients: append(longClients, "x", "y"),
+			pending:     2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := test.report.PendingClients()
+			test.report.prune()
+
+			var clients []string
+			for _, report := range test.report.Reports {
+				clients = append(clients, report.Client)
+			}
+			if fmt.Sprint(clients) != fmt.Sprint(test.wantClients) {
+				t.Errorf("kept %v, want %v", clients, test.wantClients)
+			}
+			if got := test.report.PendingClients(); got != before || got != test.pending {
+				t.Errorf("pending clients %d before and %d after, want %d", before, got, test.pending)
+			}
+		})
+	}
+}
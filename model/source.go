@@ -0,0 +1,18 @@
+package model
+
+type SourceType string
+
+const (
+	SourceTypeHLS SourceType = "hls"
+	SourceTypeMP4 SourceType = "mp4"
+)
+
+// Source is a direct media URL of a watch, playable without the embed page.
+type Source struct {
+	URL     string     `json:"url"`
+	Type    SourceType `json:"type"`
+	Quality string     `json:"quality,omitempty"`
+	// ProxyURL plays the source through the stream proxy, it is signed for
+	// each response and never stored
+	ProxyURL string `json:"proxy_url,omitempty"`
+}
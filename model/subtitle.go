@@ -0,0 +1,69 @@
+package model
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+type SubtitleFormat string
+
+const (
+	SubtitleFormatVTT SubtitleFormat = "vtt"
+	SubtitleFormatSRT SubtitleFormat = "srt"
+	SubtitleFormatASS SubtitleFormat = "ass"
+)
+
+// Subtitle is a soft subtitle track of a watch.
+type Subtitle struct {
+	// Language is the ISO 639-1 code when known, the lowercased label otherwise
+	Language string         `json:"language"`
+	Label    string         `json:"label,omitempty"`
+	Format   SubtitleFormat `json:"format"`
+	URL      string         `json:"url"`
+}
+
+var subtitleLanguages = map[string]string{
+	"indonesia":  "id",
+	"indonesian": "id",
+	"bahasa":     "id",
+	"english":    "en",
+	"japanese":   "ja",
+	"malay":      "ms",
+	"melayu":     "ms",
+}
+
+// ParseSubtitleLanguage returns the language code of a track label, e.g.
+// "Indonesian" or "en".
+func ParseSubtitleLanguage(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	for _, word := range strings.Fields(label) {
+		if language, ok := subtitleLanguages[word]; ok {
+			return language
+		}
+	}
+
+	if len(label) == 2 {
+		return label
+	}
+
+	return strings.Join(strings.Fields(label), "-")
+}
+
+// ParseSubtitleFormat returns the format of a subtitle from its URL, WebVTT
+// when the extension is unknown since it is what players use.
+func ParseSubtitleFormat(subtitleURL string) SubtitleFormat {
+	u, err := url.Parse(subtitleURL)
+	if err != nil {
+		return SubtitleFormatVTT
+	}
+
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".srt":
+		return SubtitleFormatSRT
+	case ".ass", ".ssa":
+		return SubtitleFormatASS
+	}
+
+	return SubtitleFormatVTT
+}
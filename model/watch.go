@@ -0,0 +1,135 @@
+package model
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type WatchFormat string
+
+const (
+	WatchFormatEmbed WatchFormat = "embed"
+	WatchFormatHLS   WatchFormat = "hls"
+	WatchFormatMP4   WatchFormat = "mp4"
+)
+
+type WatchTranslation string
+
+const (
+	WatchTranslationSub WatchTranslation = "sub"
+	WatchTranslationDub WatchTranslation = "dub"
+	WatchTranslationRaw WatchTranslation = "raw"
+)
+
+// DefaultWatchLanguage is the subtitle language of the source when the player
+// title does not say otherwise.
+const DefaultWatchLanguage = "id"
+
+// Qualities are the known quality labels, from the lowest to the highest.
+var Qualities = []string{"240p", "360p", "480p", "540p", "720p", "1080p", "2160p"}
+
+var (
+	qualityRegex      = regexp.MustCompile(`(?i)\b(240|360|480|540|720|1080|2160)\s*p?\b`)
+	qualityAliasRegex = regexp.MustCompile(`(?i)\b(fhd|full\s*hd|hd|sd|4k)\b`)
+	qualityAliases    = map[string]string{
+		"fhd":    "1080p",
+		"fullhd": "1080p",
+		"hd":     "720p",
+		"sd":     "480p",
+		"4k":     "2160p",
+	}
+	watchLanguages = map[string]string{
+		"indo":      "id",
+		"indonesia": "id",
+		"eng":       "en",
+		"english":   "en",
+		"jp":        "ja",
+		"jpn":       "ja",
+		"japanese":  "ja",
+	}
+	watchTranslations = map[string]WatchTranslation{
+		"sub":     WatchTranslationSub,
+		"softsub": WatchTranslationSub,
+		"hardsub": WatchTranslationSub,
+		"dub":     WatchTranslationDub,
+		"dubbed":  WatchTranslationDub,
+		"raw":     WatchTranslationRaw,
+	}
+	watchWordRegex = regexp.MustCompile(`[\pL\pN]+`)
+)
+
+// ParseQuality returns the quality label found in a player or file name,
+// e.g. "Nakama 720p" or "[FHD]".
+func ParseQuality(str string) string {
+	if match := qualityRegex.FindStringSubmatch(str); match != nil {
+		return match[1] + "p"
+	}
+
+	if match := qualityAliasRegex.FindStringSubmatch(str); match != nil {
+		return qualityAliases[strings.ToLower(strings.Join(strings.Fields(match[1]), ""))]
+	}
+
+	return ""
+}
+
+// QualityRank returns the position of the quality in Qualities, -1 when it is
+// unknown.
+func QualityRank(quality string) int {
+	for i, q := range Qualities {
+		if q == quality {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Normalize fills the parsed fields of the watch from its player title and
+// its resolved sources, see Watch.Source.
+func (w *Watch) Normalize() {
+	title := qualityRegex.ReplaceAllString(w.Source, " ")
+	title = qualityAliasRegex.ReplaceAllString(title, " ")
+
+	w.Language = DefaultWatchLanguage
+	w.Translation = WatchTranslationSub
+	var server []string
+	for _, word := range watchWordRegex.FindAllString(title, -1) {
+		lower := strings.ToLower(word)
+		if language, ok := watchLanguages[lower]; ok {
+			w.Language = language
+			continue
+		}
+		if translation, ok := watchTranslations[lower]; ok {
+			w.Translation = translation
+			continue
+		}
+
+		server = append(server, word)
+	}
+	w.Server = strings.Join(server, " ")
+	if w.Server == "" {
+		w.Server = w.Host
+	}
+
+	w.Quality = ParseQuality(w.Source)
+	w.Format = WatchFormatEmbed
+	if u, err := url.Parse(w.StreamURL); err == nil {
+		switch strings.ToLower(path.Ext(u.Path)) {
+		case ".m3u8":
+			w.Format = WatchFormatHLS
+		case ".mp4":
+			w.Format = WatchFormatMP4
+		}
+	}
+
+	for _, source := range w.Sources {
+		if w.Format != WatchFormatHLS {
+			w.Format = WatchFormat(source.Type)
+		}
+		if QualityRank(source.Quality) > QualityRank(w.Quality) {
+			w.Quality = source.Quality
+		}
+	}
+}
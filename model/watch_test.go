@@ -0,0 +1,108 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"Nakama 720p", "720p"},
+		{"Desu 1080", "1080p"},
+		{"480P Mega", "480p"},
+		{"[FHD]", "1080p"},
+		{"Full HD", "1080p"},
+		{"Pixel HD", "720p"},
+		{"sd", "480p"},
+		{"4K", "2160p"},
+		{"Ondesu 3", ""},
+		{"Nakama 7200p", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := ParseQuality(test.str); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.str, got, test.want)
+		}
+	}
+}
+
+func TestWatchNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		watch Watch
+		want  Watch
+	}{
+		{
+			name:  "player title",
+			watch: Watch{Source: "Nakama 720p", Host: "nakama.example", StreamURL: "https://nakama.example/e/1"},
+			want:  Watch{Server: "Nakama", Quality: "720p", Format: WatchFormatEmbed, Language: "id", Translation: WatchTranslationSub},
+		},
+		{
+			name:  "language and translation words",
+			watch: Watch{Source: "Mega FHD Eng Dub", Host: "mega.nz", StreamURL: "https://mega.nz/embed/1"},
+			want:  Watch{Server: "Mega", Quality: "1080p", Format: WatchFormatEmbed, Language: "en", Translation: WatchTranslationDub},
+		},
+		{
+			name:  "raw japanese",
+			watch: Watch{Source: "[RAW] Jpn Ondesu 360", Host: "ondesu.example", StreamURL: "https://ondesu.example/e/1"},
+			want:  Watch{Server: "Ondesu", Quality: "360p", Format: WatchFormatEmbed, Language: "ja", Translation: WatchTranslationRaw},
+		},
+		{
+			name:  "no server in the title uses the host",
+			watch: Watch{Source: "480p", Host: "pixeldrain.com", StreamURL: "https://pixeldrain.com/u/abc"},
+			want:  Watch{Server: "pixeldrain.com", Quality: "480p", Format: WatchFormatEmbed, Language: "id", Translation: WatchTranslationSub},
+		},
+		{
+			name:  "direct mp4 stream url",
+			watch: Watch{Source: "Direct", StreamURL: "https://cdn.example/video/ep-1.MP4?token=1"},
+			want:  Watch{Server: "Direct", Format: WatchFormatMP4, Language: "id", Translation: WatchTranslationSub},
+		},
+		{
+			name:  "direct hls stream url",
+			watch: Watch{Source: "Direct", StreamURL: "https://cdn.example/hls/master.m3u8"},
+			want:  Watch{Server: "Direct", Format: WatchFormatHLS, Language: "id", Translation: WatchTranslationSub},
+		},
+		{
+			name: "resolved sources raise the quality and set the format",
+			watch: Watch{Source: "Blogger 360p", Host: "blogger.com", StreamURL: "https://www.blogger.com/video.g?token=1", Sources: []*Source{
+				{Type: SourceTypeMP4, Quality: "360p"},
+				{Type: SourceTypeMP4, Quality: "720p"},
+			}},
+			want: Watch{Server: "Blogger", Quality: "720p", Format: WatchFormatMP4, Language: "id", Translation: WatchTranslationSub},
+		},
+		{
+			name: "an hls source wins over mp4 sources",
+			watch: Watch{Source: "Player", StreamURL: "https://player.example/e/1", Sources: []*Source{
+				{Type: SourceTypeMP4},
+				{Type: SourceTypeHLS},
+				{Type: SourceTypeMP4},
+			}},
+			want: Watch{Server: "Player", Format: WatchFormatHLS, Language: "id", Translation: WatchTranslationSub},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			watch := test.watch
+			watch.Normalize()
+
+			got := Watch{Server: watch.Server, Quality: watch.Quality, Format: watch.Format, Language: watch.Language, Translation: watch.Translation}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQualityRank(t *testing.T) {
+	if QualityRank("1080p") <= QualityRank("720p") || QualityRank("720p") <= QualityRank("360p") {
+		t.Error("qualities are not ranked from the lowest to the highest")
+	}
+	if QualityRank("") != -1 || QualityRank("999p") != -1 {
+		t.Error("unknown quality is ranked")
+	}
+}
@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"animenya.site/model"
+)
+
+func init() {
+	Register("blogger.com", &Blogger{})
+}
+
+// Blogger resolves the blogger.com video.g embeds, the page carries the
+// googlevideo streams in its VIDEO_CONFIG variable.
+type Blogger struct{}
+
+var bloggerConfigRegex = regexp.MustCompile(`VIDEO_CONFIG\s*=\s*`)
+
+// bloggerQualities maps the itag of a stream to its quality label
+var bloggerQualities = map[int]string{
+	18: "360p",
+	59: "480p",
+	22: "720p",
+	37: "1080p",
+}
+
+func (b *Blogger) Resolve(ctx context.Context, embedURL string) (*Result, error) {
+	page, err := fetch(ctx, embedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := b.parse(page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Sources: sources}, nil
+}
+
+func (b *Blogger) parse(page string) ([]*model.Source, error) {
+	match := bloggerConfigRegex.FindStringIndex(page)
+	if match == nil {
+		return nil, fmt.Errorf("VIDEO_CONFIG_NOT_FOUND")
+	}
+
+	var config struct {
+		Streams []struct {
+			PlayURL  string `json:"play_url"`
+			FormatID int    `json:"format_id"`
+		} `json:"streams"`
+	}
+	// the decoder stops at the end of the object, ignoring the script after it
+	if err := json.NewDecoder(strings.NewReader(page[match[1]:])).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	var sources []*model.Source
+	for _, stream := range config.Streams {
+		if stream.PlayURL == "" {
+			continue
+		}
+
+		sources = append(sources, &model.Source{
+			URL:     stream.PlayURL,
+			Type:    model.SourceTypeMP4,
+			Quality: bloggerQualities[stream.FormatID],
+		})
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("NO_SOURCE_FOUND")
+	}
+
+	return sources, nil
+}
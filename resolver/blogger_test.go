@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBloggerParse(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		qualities []string
+		err       string
+	}{
+		{fixture: "blogger.html", qualities: []string{"360p", "720p"}},
+		{fixture: "blogger_no_streams.html", err: "NO_SOURCE_FOUND"},
+		{fixture: "pixeldrain_video.json", err: "VIDEO_CONFIG_NOT_FOUND"},
+	}
+
+	for _, test := range tests {
+		page, err := os.ReadFile("testdata/" + test.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sources, err := (&Blogger{}).parse(string(page))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got error %v, want %s", test.fixture, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.fixture, err)
+			continue
+		}
+
+		if len(sources) != len(test.qualities) {
+			t.Errorf("%s: got %d sources, want %d", test.fixture, len(sources), len(test.qualities))
+			continue
+		}
+		for i, source := range sources {
+			if source.Quality != test.qualities[i] {
+				t.Errorf("%s: source %d quality = %q, want %q", test.fixture, i, source.Quality, test.qualities[i])
+			}
+			if source.URL == "" || source.Type != "mp4" {
+				t.Errorf("%s: source %d = %+v", test.fixture, i, source)
+			}
+		}
+	}
+}
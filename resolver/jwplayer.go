@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"animenya.site/model"
+	"github.com/rs/zerolog/log"
+)
+
+// registerJWPlayerHosts registers the JW Player embeds, they have no common
+// domain so their hosts are listed in the JWPLAYER_HOSTS env, comma separated.
+// JW Player is the only player with subtitle tracks, without any host the
+// watches have no subtitles. It runs on the first lookup since the env is
+// loaded after the package init.
+func registerJWPlayerHosts() {
+	var registered int
+	for _, host := range strings.Split(os.Getenv("JWPLAYER_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			Register(host, &JWPlayer{})
+			registered++
+		}
+	}
+
+	if registered == 0 {
+		log.Warn().Msg("resolver.registerJWPlayerHosts: JWPLAYER_HOSTS is empty, the watches will have no subtitles")
+	}
+}
+
+// JWPlayer resolves the embeds setting up a JW Player with plain sources and
+// tracks arrays.
+type JWPlayer struct{}
+
+var (
+	jwplayerSourcesRegex = regexp.MustCompile(`(?s)["']?sources["']?\s*:\s*\[(.*?)\]`)
+	jwplayerTracksRegex  = regexp.MustCompile(`(?s)["']?tracks["']?\s*:\s*\[(.*?)\]`)
+	jwplayerObjectRegex  = regexp.MustCompile(`(?s)\{([^{}]*)\}`)
+	// jwplayerFieldRegexes match the string value of the keys read by
+	// jwplayerField, quoted or not
+	jwplayerFieldRegexes = map[string]*regexp.Regexp{}
+)
+
+func init() {
+	for _, key := range []string{"file", "type", "label", "kind"} {
+		jwplayerFieldRegexes[key] = regexp.MustCompile(`["']?` + key + `["']?\s*:\s*["']([^"']*)["']`)
+	}
+}
+
+func (j *JWPlayer) Resolve(ctx context.Context, embedURL string) (*Result, error) {
+	page, err := fetch(ctx, embedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(absoluteURL(embedURL))
+	if err != nil {
+		return nil, err
+	}
+
+	return j.parse(page, base)
+}
+
+func (j *JWPlayer) parse(page string, base *url.URL) (*Result, error) {
+	var result Result
+	if match := jwplayerSourcesRegex.FindStringSubmatch(page); match != nil {
+		for _, object := range jwplayerObjectRegex.FindAllStringSubmatch(match[1], -1) {
+			file := resolveURL(base, jwplayerField(object[1], "file"))
+			if file == "" {
+				continue
+			}
+
+			sourceType := model.SourceTypeMP4
+			if strings.Contains(strings.ToLower(file), ".m3u8") || strings.Contains(jwplayerField(object[1], "type"), "hls") {
+				sourceType = model.SourceTypeHLS
+			}
+
+			result.Sources = append(result.Sources, &model.Source{
+				URL:     file,
+				Type:    sourceType,
+				Quality: model.ParseQuality(jwplayerField(object[1], "label")),
+			})
+		}
+	}
+
+	if match := jwplayerTracksRegex.FindStringSubmatch(page); match != nil {
+		for _, object := range jwplayerObjectRegex.FindAllStringSubmatch(match[1], -1) {
+			// thumbnails and chapters are tracks too
+			kind := jwplayerField(object[1], "kind")
+			if kind != "" && kind != "captions" && kind != "subtitles" {
+				continue
+			}
+
+			file := resolveURL(base, jwplayerField(object[1], "file"))
+			if file == "" {
+				continue
+			}
+
+			label := jwplayerField(object[1], "label")
+			result.Subtitles = append(result.Subtitles, &model.Subtitle{
+				Language: model.ParseSubtitleLanguage(label),
+				Label:    label,
+				Format:   model.ParseSubtitleFormat(file),
+				URL:      file,
+			})
+		}
+	}
+
+	if len(result.Sources) == 0 {
+		return nil, fmt.Errorf("NO_SOURCE_FOUND")
+	}
+
+	return &result, nil
+}
+
+// jwplayerField returns the string value of a key in a JS object literal, the
+// key must be one of jwplayerFieldRegexes.
+func jwplayerField(object string, key string) string {
+	if match := jwplayerFieldRegexes[key].FindStringSubmatch(object); match != nil {
+		return strings.ReplaceAll(match[1], `\/`, "/")
+	}
+
+	return ""
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	return u.String()
+}
@@ -0,0 +1,93 @@
+package resolver
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestJWPlayerResolve(t *testing.T) {
+	server := serveFixtures(t, map[string]string{
+		"/e/abc":   "jwplayer.html",
+		"/e/empty": "jwplayer_no_sources.html",
+	})
+
+	type source struct{ url, typ, quality string }
+	type subtitle struct{ url, language, format string }
+	tests := []struct {
+		name      string
+		embedURL  string
+		sources   []source
+		subtitles []subtitle
+		err       string
+	}{
+		{
+			name:     "sources and captions",
+			embedURL: server.URL + "/e/abc",
+			sources: []source{
+				{"https://cdn.example.com/hls/abc/master.m3u8", "hls", "1080p"},
+				{server.URL + "/media/abc_480.mp4", "mp4", "480p"},
+			},
+			subtitles: []subtitle{
+				{"https://subs.example.com/abc/id.vtt", "id", "vtt"},
+				{server.URL + "/subs/abc_en.srt", "en", "srt"},
+			},
+		},
+		{
+			name:     "protocol relative embed",
+			embedURL: strings.TrimPrefix(server.URL, "https:") + "/e/abc",
+			sources: []source{
+				{"https://cdn.example.com/hls/abc/master.m3u8", "hls", "1080p"},
+				{server.URL + "/media/abc_480.mp4", "mp4", "480p"},
+			},
+			subtitles: []subtitle{
+				{"https://subs.example.com/abc/id.vtt", "id", "vtt"},
+				{server.URL + "/subs/abc_en.srt", "en", "srt"},
+			},
+		},
+		{name: "no sources", embedURL: server.URL + "/e/empty", err: "NO_SOURCE_FOUND"},
+		{name: "missing embed", embedURL: server.URL + "/e/gone", err: "NOT_FOUND"},
+	}
+
+	for _, test := range tests {
+		result, err := (&JWPlayer{}).Resolve(context.Background(), test.embedURL)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got error %v, want %s", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var sources []source
+		for _, s := range result.Sources {
+			sources = append(sources, source{s.URL, string(s.Type), s.Quality})
+		}
+		if len(sources) != len(test.sources) {
+			t.Errorf("%s: got sources %v, want %v", test.name, sources, test.sources)
+		} else {
+			for i := range sources {
+				if sources[i] != test.sources[i] {
+					t.Errorf("%s: source %d = %v, want %v", test.name, i, sources[i], test.sources[i])
+				}
+			}
+		}
+
+		var subtitles []subtitle
+		for _, s := range result.Subtitles {
+			subtitles = append(subtitles, subtitle{s.URL, s.Language, string(s.Format)})
+		}
+		if len(subtitles) != len(test.subtitles) {
+			t.Errorf("%s: got subtitles %v, want %v", test.name, subtitles, test.subtitles)
+		} else {
+			for i := range subtitles {
+				if subtitles[i] != test.subtitles[i] {
+					t.Errorf("%s: subtitle %d = %v, want %v", test.name, i, subtitles[i], test.subtitles[i])
+				}
+			}
+		}
+	}
+}
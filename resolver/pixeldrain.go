@@ -0,0 +1,60 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"animenya.site/model"
+)
+
+func init() {
+	Register("pixeldrain.com", &Pixeldrain{})
+}
+
+// Pixeldrain resolves the pixeldrain.com file pages, the file is served as is
+// by the public file API.
+type Pixeldrain struct{}
+
+var pixeldrainIDRegex = regexp.MustCompile(`/(?:u|api/file)/([A-Za-z0-9]+)`)
+
+func (p *Pixeldrain) Resolve(ctx context.Context, embedURL string) (*Result, error) {
+	u, err := url.Parse(absoluteURL(embedURL))
+	if err != nil {
+		return nil, err
+	}
+
+	match := pixeldrainIDRegex.FindStringSubmatch(u.Path)
+	if match == nil {
+		return nil, fmt.Errorf("FILE_ID_NOT_FOUND")
+	}
+
+	api := fmt.Sprintf("%s://%s/api/file/%s", u.Scheme, u.Host, match[1])
+	page, err := fetch(ctx, api+"/info")
+	if err != nil {
+		return nil, err
+	}
+
+	var info struct {
+		Name     string `json:"name"`
+		MimeType string `json:"mime_type"`
+	}
+	if err := json.Unmarshal([]byte(page), &info); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(info.MimeType, "video/") {
+		return nil, fmt.Errorf("NOT_A_VIDEO")
+	}
+
+	return &Result{
+		Sources: []*model.Source{{
+			URL:     api,
+			Type:    model.SourceTypeMP4,
+			Quality: model.ParseQuality(info.Name),
+		}},
+	}, nil
+}
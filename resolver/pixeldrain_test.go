@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// serveFixtures serves testdata/<name> for the paths of the routes.
+func serveFixtures(t *testing.T, routes map[string]string) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		content, err := os.ReadFile("testdata/" + fixture)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(content)
+	}))
+
+	_client := client
+	client = server.Client()
+	t.Cleanup(func() {
+		client = _client
+		server.Close()
+	})
+
+	return server
+}
+
+func TestPixeldrainResolve(t *testing.T) {
+	server := serveFixtures(t, map[string]string{
+		"/api/file/abc123/info": "pixeldrain_video.json",
+		"/api/file/img456/info": "pixeldrain_image.json",
+	})
+	host := strings.TrimPrefix(server.URL, "https:")
+
+	tests := []struct {
+		name     string
+		embedURL string
+		source   string
+		quality  string
+		err      string
+	}{
+		{
+			name:     "file page",
+			embedURL: server.URL + "/u/abc123",
+			source:   server.URL + "/api/file/abc123",
+			quality:  "720p",
+		},
+		{
+			name:     "protocol relative",
+			embedURL: host + "/u/abc123?embed",
+			source:   server.URL + "/api/file/abc123",
+			quality:  "720p",
+		},
+		{name: "not a video", embedURL: server.URL + "/u/img456", err: "NOT_A_VIDEO"},
+		{name: "unknown file", embedURL: server.URL + "/u/gone", err: "NOT_FOUND"},
+		{name: "no file id", embedURL: server.URL + "/l/list", err: "FILE_ID_NOT_FOUND"},
+	}
+
+	for _, test := range tests {
+		result, err := (&Pixeldrain{}).Resolve(context.Background(), test.embedURL)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got error %v, want %s", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if len(result.Sources) != 1 {
+			t.Errorf("%s: got %d sources, want 1", test.name, len(result.Sources))
+			continue
+		}
+		if source := result.Sources[0]; source.URL != test.source || source.Quality != test.quality {
+			t.Errorf("%s: got %+v, want %s %s", test.name, source, test.source, test.quality)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"animenya.site/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// resolveTimeout bounds a whole ResolveWatches call, not each watch
+	resolveTimeout = time.Second * 10
+	// resolveConcurrency is the number of watches resolved at once
+	resolveConcurrency = 4
+	// maxPageSize is the maximum size of an embed page read by a resolver
+	maxPageSize = 2 << 20
+)
+
+// Resolver turns the embed URL of a stream host into direct media sources and
+// the subtitle tracks of the player.
+type Resolver interface {
+	Resolve(ctx context.Context, embedURL string) (*Result, error)
+}
+
+type Result struct {
+	Sources   []*model.Source
+	Subtitles []*model.Subtitle
+}
+
+var (
+	mu        sync.RWMutex
+	resolvers = map[string]Resolver{}
+	envOnce   sync.Once
+)
+
+// Register adds the resolver of an embed host, it is also used for the
+// subdomains of the host.
+func Register(host string, resolver Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resolvers[strings.TrimPrefix(host, "www.")] = resolver
+}
+
+// For returns the resolver of the host or its parent domain.
+func For(host string) (Resolver, bool) {
+	envOnce.Do(registerJWPlayerHosts)
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for {
+		if resolver, ok := resolvers[host]; ok {
+			return resolver, true
+		}
+
+		i := strings.Index(host, ".")
+		if i < 0 {
+			return nil, false
+		}
+		host = host[i+1:]
+	}
+}
+
+// ResolveWatches sets the sources and subtitles of every watch with a known
+// host, a watch that fails to resolve keeps only its embed URL. The watches are
+// resolved concurrently within resolveTimeout and the deadline of the context,
+// the ones not done by then keep only their embed URL too.
+func ResolveWatches(ctx context.Context, watches []*model.Watch) {
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, resolveConcurrency)
+	for _, watch := range watches {
+		resolver, ok := For(watch.Host)
+		if !ok {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(watch *model.Watch, resolver Resolver) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result, err := resolver.Resolve(ctx, watch.StreamURL)
+			if err != nil {
+				log.Warn().Err(err).Str("host", watch.Host).Msg("resolver.ResolveWatches: failed to resolve watch")
+				return
+			}
+
+			watch.Sources = result.Sources
+			watch.Subtitles = result.Subtitles
+			watch.Normalize()
+		}(watch, resolver)
+	}
+
+	wg.Wait()
+}
+
+var client = &http.Client{Timeout: resolveTimeout}
+
+// absoluteURL gives the protocol relative URLs used by some players, e.g.
+// "//host/embed", the https scheme.
+func absoluteURL(u string) string {
+	if strings.HasPrefix(u, "//") {
+		return "https:" + u
+	}
+
+	return u
+}
+
+// fetch returns the body of the embed page, requested as if embedded by the
+// source site.
+func fetch(ctx context.Context, pageURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, absoluteURL(pageURL), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("referer", os.Getenv("SOURCE_URL"))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("NOT_FOUND")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("STATUS_CODE_NOT_OK")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"animenya.site/model"
+)
+
+// slowResolver resolves after the delay, or fails when the context is done
+// first, and records the most resolves running at once.
+type slowResolver struct {
+	delay   time.Duration
+	mu      sync.Mutex
+	running int
+	most    int
+}
+
+func (r *slowResolver) Resolve(ctx context.Context, embedURL string) (*Result, error) {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.most {
+		r.most = r.running
+	}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.running--
+		r.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(r.delay):
+		return &Result{Sources: []*model.Source{{URL: embedURL + "/video.mp4"}}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestResolveWatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		deadline time.Duration
+		resolved int
+	}{
+		{"every watch resolves", time.Millisecond * 50, time.Second, 8},
+		{"the deadline of the context bounds every watch", time.Second, time.Millisecond * 100, 0},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			host := fmt.Sprintf("slow%d.test", i)
+			resolver := &slowResolver{delay: test.delay}
+			Register(host, resolver)
+
+			var watches []*model.Watch
+			for i := 0; i < 8; i++ {
+				watches = append(watches, &model.Watch{Host: host, StreamURL: fmt.Sprintf("https://%s/e/%d", host, i)})
+			}
+			// an unknown host is skipped
+			watches = append(watches, &model.Watch{Host: "unknown.test", StreamURL: "https://unknown.test/e/1"})
+
+			ctx, cancel := context.WithTimeout(context.Background(), test.deadline)
+			defer cancel()
+
+			start := time.Now()
+			ResolveWatches(ctx, watches)
+			elapsed := time.Since(start)
+
+			// 8 watches of 50ms take 100ms with 4 at once, 400ms one by one
+			if elapsed > test.deadline+time.Millisecond*100 || elapsed > time.Millisecond*300 {
+				t.Errorf("took %s", elapsed)
+			}
+			if resolver.most > resolveConcurrency {
+				t.Errorf("%d resolves at once, want at most %d", resolver.most, resolveConcurrency)
+			}
+
+			resolved := 0
+			for _, watch := range watches {
+				if len(watch.Sources) > 0 {
+					resolved++
+				}
+			}
+			if resolved != test.resolved {
+				t.Errorf("%d watches resolved, want %d", resolved, test.resolved)
+			}
+		})
+	}
+}
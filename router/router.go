@@ -1,8 +1,18 @@
 package router
 
 import (
+	"time"
+
 	"animenya.site/handler"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+const (
+	// reportLimit is the number of watch reports a client can send per
+	// reportLimitWindow
+	reportLimit       = 10
+	reportLimitWindow = time.Hour
 )
 
 func SetupRoutes(app *fiber.App, handler *handler.Handler) {
@@ -10,10 +20,35 @@ func SetupRoutes(app *fiber.App, handler *handler.Handler) {
 		return c.SendString("pong")
 	})
 
+	app.Get("/movies", handler.Movies)
+	app.Get("/stream/:token/*", handler.Stream)
+
+	admin := app.Group("/admin")
+	admin.Get("/reports", handler.Reports)
+	admin.Post("/reports/:report_id/dismiss", handler.DismissReport)
+
 	anime := app.Group("/anime")
 	anime.Get("/", handler.LatestAnimeEpisode)
 	anime.Get("/search", handler.SearchAnime)
+	anime.Get("/suggest", handler.SuggestAnime)
 	anime.Get("/:anime_id", handler.Anime)
 	anime.Get("/:anime_id/cover", handler.AnimeCover)
 	anime.Get("/:anime_id/episode/:episode_id", handler.Episode)
+	anime.Get("/:anime_id/episode/:episode_id/siblings", handler.EpisodeSiblings)
+	anime.Get("/:anime_id/episode/:episode_id/downloads", handler.EpisodeDownloads)
+	anime.Get("/:anime_id/episode/:episode_id/thumbnail", handler.EpisodeThumbnail)
+	anime.Get("/:anime_id/episode/:episode_id/subtitles/:lang", handler.Subtitle)
+	anime.Post("/:anime_id/episode/:episode_id/watches/:watch_id/report", limiter.New(limiter.Config{
+		Max:        reportLimit,
+		Expiration: reportLimitWindow,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return handler.ClientIP(c)
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"data":  nil,
+				"error": "TOO_MANY_REQUESTS",
+			})
+		},
+	}), handler.ReportWatch)
 }
@@ -0,0 +1,184 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"animenya.site/model"
+)
+
+type Sort string
+
+const (
+	SortRelevance Sort = "relevance"
+	SortScore     Sort = "score"
+	SortTitle     Sort = "title"
+	SortLatest    Sort = "latest"
+)
+
+func ParseSort(str string) Sort {
+	switch Sort(strings.ToLower(strings.TrimSpace(str))) {
+	case "", SortRelevance:
+		return SortRelevance
+	case SortScore:
+		return SortScore
+	case SortTitle:
+		return SortTitle
+	case SortLatest:
+		return SortLatest
+	}
+
+	return ""
+}
+
+// Filter narrows down the catalog, zero values are ignored.
+type Filter struct {
+	// Genres must all be present, matched by slug or name
+	Genres        []string
+	ExcludeGenres []string
+	Status        model.AnimeStatus
+	Type          model.AnimeType
+	// Season is matched against the season label, e.g. "fall"
+	Season   string
+	Year     int
+	MinScore float64
+	MaxScore float64
+	Studio   string
+}
+
+func (f *Filter) IsEmpty() bool {
+	return len(f.Genres) == 0 && len(f.ExcludeGenres) == 0 && f.Status == "" && f.Type == "" &&
+		f.Season == "" && f.Year == 0 && f.MinScore == 0 && f.MaxScore == 0 && f.Studio == ""
+}
+
+func (f *Filter) Match(doc *Document) bool {
+	a := doc.Anime
+	for _, genre := range f.Genres {
+		if !hasGenre(a, genre) {
+			return false
+		}
+	}
+
+	for _, genre := range f.ExcludeGenres {
+		if hasGenre(a, genre) {
+			return false
+		}
+	}
+
+	if f.Status != "" && a.Status != f.Status {
+		return false
+	}
+
+	if f.Type != "" && a.Type != f.Type {
+		return false
+	}
+
+	if f.Season != "" && (a.Season == nil || !strings.Contains(strings.ToLower(*a.Season), strings.ToLower(f.Season))) {
+		return false
+	}
+
+	if f.Year != 0 && !hasYear(a, f.Year) {
+		return false
+	}
+
+	if f.MinScore != 0 && a.Score < f.MinScore {
+		return false
+	}
+
+	if f.MaxScore != 0 && a.Score > f.MaxScore {
+		return false
+	}
+
+	if f.Studio != "" && (a.Studio == nil || !strings.EqualFold(strings.TrimSpace(*a.Studio), strings.TrimSpace(f.Studio))) {
+		return false
+	}
+
+	return true
+}
+
+func hasGenre(a *model.Anime, genre string) bool {
+	if a.Genre == nil {
+		return false
+	}
+
+	for _, g := range *a.Genre {
+		if strings.EqualFold(g.Slug, genre) || strings.EqualFold(g.Name, genre) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasYear(a *model.Anime, year int) bool {
+	_year := strconv.Itoa(year)
+	if a.ReleaseDate != nil && strings.HasPrefix(*a.ReleaseDate, _year) {
+		return true
+	}
+
+	return a.Season != nil && strings.Contains(*a.Season, _year)
+}
+
+func sortResults(results []*Result, by Sort) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch by {
+		case SortScore:
+			if a.Anime.Score != b.Anime.Score {
+				return a.Anime.Score > b.Anime.Score
+			}
+		case SortTitle:
+			titleA, titleB := strings.ToLower(a.Anime.Title), strings.ToLower(b.Anime.Title)
+			if titleA != titleB {
+				return titleA < titleB
+			}
+		case SortLatest:
+			if a.LatestEpisodeAt == nil || b.LatestEpisodeAt == nil {
+				if (a.LatestEpisodeAt == nil) != (b.LatestEpisodeAt == nil) {
+					return b.LatestEpisodeAt == nil
+				}
+			} else if !a.LatestEpisodeAt.Equal(*b.LatestEpisodeAt) {
+				return a.LatestEpisodeAt.After(*b.LatestEpisodeAt)
+			}
+		}
+
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Anime.ID > b.Anime.ID
+	})
+}
+
+// Browse returns the documents matching the filter without a query, an empty
+// filter matches the whole catalog.
+func (idx *Index) Browse(opts Options) []*Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var results []*Result
+	for _, doc := range idx.docs {
+		if !opts.Filter.Match(doc) {
+			continue
+		}
+
+		results = append(results, &Result{Document: doc})
+	}
+
+	sortResults(results, opts.Sort)
+	return paginate(results, opts)
+}
+
+// paginate returns the results from the offset of the options, at most limit
+// of them.
+func paginate(results []*Result, opts Options) []*Result {
+	if opts.Offset >= len(results) {
+		return nil
+	}
+	results = results[opts.Offset:]
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+
+	return results
+}
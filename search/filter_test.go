@@ -0,0 +1,49 @@
+package search
+
+import (
+	"testing"
+
+	"animenya.site/model"
+)
+
+func TestBrowse(t *testing.T) {
+	fall, winter := "Fall 2023", "Winter 2024"
+	idx := New()
+	idx.add([]*model.Anime{
+		{ID: 1, Title: "Frieren", Score: 9.3, Season: &fall},
+		{ID: 2, Title: "Kusuriya no Hitorigoto", Score: 8.9, Season: &fall},
+		{ID: 3, Title: "Solo Leveling", Score: 8.3, Season: &winter},
+		{ID: 4, Title: "Dungeon Meshi", Score: 8.6, Season: &winter},
+	})
+
+	tests := []struct {
+		name string
+		opts Options
+		want []int
+	}{
+		{"sort only", Options{Sort: SortScore}, []int{1, 2, 4, 3}},
+		{"sort only by title", Options{Sort: SortTitle}, []int{4, 1, 2, 3}},
+		{"paged", Options{Sort: SortScore, Limit: 2, Offset: 2}, []int{4, 3}},
+		{"past the end", Options{Sort: SortScore, Limit: 2, Offset: 4}, nil},
+		{"season", Options{Sort: SortScore, Filter: Filter{Season: "fall"}}, []int{1, 2}},
+		{"year", Options{Sort: SortScore, Filter: Filter{Year: 2024}}, []int{4, 3}},
+	}
+
+	for _, test := range tests {
+		var got []int
+		for _, r := range idx.Browse(test.opts) {
+			got = append(got, r.Anime.ID)
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package search
+
+import (
+	"strings"
+
+	"animenya.site/data"
+)
+
+// romanizations folds the common ways of writing japanese long vowels and
+// particles into a single spelling, e.g. "kyoujin", "kyōjin" and "kyoojin"
+// all become "kyojin".
+var romanizations = strings.NewReplacer(
+	"ā", "a", "ī", "i", "ū", "u", "ē", "e", "ō", "o",
+	"â", "a", "î", "i", "û", "u", "ê", "e", "ô", "o",
+	"ou", "o", "oo", "o", "uu", "u", "aa", "a", "ii", "i", "ee", "e",
+)
+
+// NormalizeTerm returns the romanization independent spelling of a term.
+func NormalizeTerm(term string) string {
+	if term == "wo" {
+		return "o"
+	}
+
+	return romanizations.Replace(term)
+}
+
+// aliasQueries returns the queries to run in addition to the given one, using
+// the known english names and nicknames of anime. Aliases only match whole
+// words, so "slime" does not match "slimes".
+func aliasQueries(query string) []string {
+	terms := Tokenize(query)
+
+	var queries []string
+	for alias, title := range data.AnimeAliases {
+		aliasTerms, titleTerms := Tokenize(alias), Tokenize(title)
+		if replaced, ok := replaceTerms(terms, aliasTerms, titleTerms); ok {
+			queries = append(queries, replaced)
+		} else if replaced, ok := replaceTerms(terms, titleTerms, aliasTerms); ok {
+			queries = append(queries, replaced)
+		}
+	}
+
+	return queries
+}
+
+// replaceTerms replaces the first run of old in terms with new and joins the
+// result into a query.
+func replaceTerms(terms, old, new []string) (string, bool) {
+	if len(old) == 0 {
+		return "", false
+	}
+
+	for i := 0; i+len(old) <= len(terms); i++ {
+		match := true
+		for j := range old {
+			if terms[i+j] != old[j] {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+
+		var replaced []string
+		replaced = append(replaced, terms[:i]...)
+		replaced = append(replaced, new...)
+		replaced = append(replaced, terms[i+len(old):]...)
+		return strings.Join(replaced, " "), true
+	}
+
+	return "", false
+}
+
+func trigrams(term string) []string {
+	runes := []rune("  " + term + " ")
+	var result []string
+	for i := 0; i+3 <= len(runes); i++ {
+		result = append(result, string(runes[i:i+3]))
+	}
+
+	return result
+}
+
+// maxEdits is the number of typos tolerated for a term of the given length.
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// expand returns the indexed terms close enough to the given term, with their
+// similarity between 0 and 1. It must be called with the read lock held.
+func (idx *Index) expand(term string) map[string]float64 {
+	result := map[string]float64{}
+	if _, ok := idx.postings[term]; ok {
+		result[term] = 1
+	}
+
+	edits := maxEdits(term)
+	if edits == 0 {
+		return result
+	}
+
+	grams := trigrams(term)
+	shared := map[string]int{}
+	for _, gram := range grams {
+		for candidate := range idx.trigrams[gram] {
+			shared[candidate]++
+		}
+	}
+
+	for candidate, count := range shared {
+		if candidate == term || count < len(grams)-3*edits {
+			continue
+		}
+
+		distance := levenshtein(term, candidate)
+		if distance > edits {
+			continue
+		}
+
+		length := len([]rune(term))
+		if l := len([]rune(candidate)); l > length {
+			length = l
+		}
+		result[candidate] = 1 - float64(distance)/float64(length)
+	}
+
+	return result
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+
+	return result
+}
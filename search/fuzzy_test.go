@@ -0,0 +1,29 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestAliasQueries(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"attack on titan season 2", []string{"shingeki no kyojin season 2"}},
+		{"Shingeki no Kyoujin", []string{"aot", "attack on titan"}},
+		{"slime", []string{"tensei shitara slime datta ken"}},
+		{"slimes", nil},
+		{"frierens", nil},
+		{"the spy family", []string{"the spy x family"}},
+	}
+
+	for _, test := range tests {
+		got := aliasQueries(test.query)
+		sort.Strings(got)
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%q: got %q, want %q", test.query, got, test.want)
+		}
+	}
+}
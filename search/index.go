@@ -0,0 +1,305 @@
+package search
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"animenya.site/db"
+	"animenya.site/model"
+)
+
+// field weights used when ranking a document
+const (
+	weightTitle            = 5.0
+	weightAlternativeTitle = 4.0
+	weightGenre            = 2.0
+	weightStudio           = 2.0
+	weightSynopsis         = 1.0
+	weightPhrase           = 10.0
+)
+
+type Document struct {
+	Anime           *model.Anime
+	LatestEpisodeAt *time.Time
+}
+
+type Result struct {
+	*Document
+	Score float64
+}
+
+type Options struct {
+	Limit int
+	// Offset skips the first results, it is used to page through Search and
+	// Browse.
+	Offset int
+	// Fuzzy also matches terms with typos, see Index.expand.
+	Fuzzy  bool
+	Filter Filter
+	Sort   Sort
+}
+
+// Index is an in memory inverted index over the stored anime.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[int]*Document
+	terms    map[int][]string
+	postings map[string]map[int]float64
+	trigrams map[string]map[string]struct{}
+
+	// prefixes is sorted by key, see Suggest
+	prefixes   []prefixEntry
+	prefixKeys map[int][]prefixEntry
+}
+
+func New() *Index {
+	return &Index{
+		docs:       map[int]*Document{},
+		terms:      map[int][]string{},
+		postings:   map[string]map[int]float64{},
+		trigrams:   map[string]map[string]struct{}{},
+		prefixKeys: map[int][]prefixEntry{},
+	}
+}
+
+// Build indexes every anime stored in the db.
+func (idx *Index) Build(db db.DBInterface) error {
+	anime, err := model.ListAnime(db)
+	if err != nil {
+		return err
+	}
+
+	idx.add(anime)
+	return nil
+}
+
+// Add indexes the anime, replacing the previous version of it if any.
+func (idx *Index) Add(a *model.Anime) {
+	idx.add([]*model.Anime{a})
+}
+
+// indexed is an anime ready to be added to the index.
+type indexed struct {
+	doc        *Document
+	terms      map[string]float64
+	prefixKeys []prefixEntry
+}
+
+// add indexes every anime, the prefixes of all of them are merged at once.
+func (idx *Index) add(anime []*model.Anime) {
+	var batch []*indexed
+	var prefixKeys []prefixEntry
+	for _, a := range anime {
+		entry := newIndexed(a)
+		if entry == nil {
+			continue
+		}
+		batch = append(batch, entry)
+		prefixKeys = append(prefixKeys, entry.prefixKeys...)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, entry := range batch {
+		id := entry.doc.Anime.ID
+		idx.remove(id)
+		idx.docs[id] = entry.doc
+		idx.prefixKeys[id] = entry.prefixKeys
+		for term, weight := range entry.terms {
+			if idx.postings[term] == nil {
+				idx.postings[term] = map[int]float64{}
+				for _, gram := range trigrams(term) {
+					if idx.trigrams[gram] == nil {
+						idx.trigrams[gram] = map[string]struct{}{}
+					}
+					idx.trigrams[gram][term] = struct{}{}
+				}
+			}
+			idx.postings[term][id] = weight
+			idx.terms[id] = append(idx.terms[id], term)
+		}
+	}
+	idx.addPrefixes(prefixKeys)
+}
+
+func newIndexed(a *model.Anime) *indexed {
+	if a == nil || a.ID == 0 {
+		return nil
+	}
+
+	doc := &Document{Anime: &model.Anime{}}
+	*doc.Anime = *a
+	doc.Anime.Episodes = nil
+	for _, episode := range a.Episodes {
+		if episode.CreatedAt == nil {
+			continue
+		}
+		if doc.LatestEpisodeAt == nil || episode.CreatedAt.After(*doc.LatestEpisodeAt) {
+			doc.LatestEpisodeAt = episode.CreatedAt
+		}
+	}
+
+	terms := map[string]float64{}
+	addTerms := func(str string, weight float64) {
+		for _, term := range Tokenize(str) {
+			terms[term] += weight
+		}
+	}
+
+	addTerms(a.Title, weightTitle)
+	for _, title := range a.AlternativeTitles {
+		addTerms(title, weightAlternativeTitle)
+	}
+	if a.Genre != nil {
+		for _, genre := range *a.Genre {
+			addTerms(genre.Name, weightGenre)
+		}
+	}
+	if a.Studio != nil {
+		addTerms(*a.Studio, weightStudio)
+	}
+	if a.Synopsis != nil {
+		addTerms(*a.Synopsis, weightSynopsis)
+	}
+
+	return &indexed{
+		doc:        doc,
+		terms:      terms,
+		prefixKeys: titleKeys(a.ID, append([]string{a.Title}, a.AlternativeTitles...)),
+	}
+}
+
+func (idx *Index) remove(id int) {
+	if _, ok := idx.docs[id]; !ok {
+		return
+	}
+
+	for _, term := range idx.terms[id] {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+			for _, gram := range trigrams(term) {
+				delete(idx.trigrams[gram], term)
+				if len(idx.trigrams[gram]) == 0 {
+					delete(idx.trigrams, gram)
+				}
+			}
+		}
+	}
+	idx.removePrefixes(idx.prefixKeys[id])
+	delete(idx.prefixKeys, id)
+	delete(idx.terms, id)
+	delete(idx.docs, id)
+}
+
+// Get returns the indexed document of the anime.
+func (idx *Index) Get(id int) *Document {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.docs[id]
+}
+
+// Search returns the documents matching every term of the query, ordered by
+// relevance. When no document matches every term, documents matching any of
+// them are returned instead. Known aliases of the query are searched too.
+func (idx *Index) Search(query string, opts Options) []*Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	best := map[int]*Result{}
+	for _, q := range append([]string{query}, aliasQueries(query)...) {
+		for _, r := range idx.search(q, opts) {
+			if current, ok := best[r.Anime.ID]; !ok || r.Score > current.Score {
+				best[r.Anime.ID] = r
+			}
+		}
+	}
+
+	var results []*Result
+	for _, r := range best {
+		if !opts.Filter.Match(r.Document) {
+			continue
+		}
+
+		results = append(results, r)
+	}
+
+	sortResults(results, opts.Sort)
+	return paginate(results, opts)
+}
+
+func (idx *Index) search(query string, opts Options) []*Result {
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	scores := map[int]float64{}
+	matches := map[int]int{}
+	for _, term := range terms {
+		expansions := map[string]float64{term: 1}
+		if opts.Fuzzy {
+			expansions = idx.expand(term)
+		}
+
+		// a document counts once per query term, with its best expansion
+		termScores := map[int]float64{}
+		for expansion, similarity := range expansions {
+			posting := idx.postings[expansion]
+			idf := math.Log(1 + float64(len(idx.docs))/float64(len(posting)+1))
+			for id, weight := range posting {
+				if score := weight * idf * similarity; score > termScores[id] {
+					termScores[id] = score
+				}
+			}
+		}
+
+		for id, score := range termScores {
+			scores[id] += score
+			matches[id]++
+		}
+	}
+
+	all := false
+	for _, count := range matches {
+		if count == len(terms) {
+			all = true
+			break
+		}
+	}
+
+	phrase := strings.Join(terms, " ")
+	var results []*Result
+	for id, score := range scores {
+		if all && matches[id] < len(terms) {
+			continue
+		}
+
+		doc := idx.docs[id]
+		if strings.Contains(strings.Join(Tokenize(doc.Anime.Title), " "), phrase) {
+			score += weightPhrase
+		}
+
+		results = append(results, &Result{Document: doc, Score: score})
+	}
+
+	return results
+}
+
+// Tokenize lowercases the string, splits it into letter and digit terms and
+// normalizes their romanization.
+func Tokenize(str string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(str), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, term := range terms {
+		terms[i] = NormalizeTerm(term)
+	}
+
+	return terms
+}
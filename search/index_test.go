@@ -0,0 +1,78 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"animenya.site/model"
+)
+
+func TestSearchRanking(t *testing.T) {
+	synopsis := "A ninja story told by a naruto fan"
+	studio := "Pierrot"
+	idx := New()
+	idx.add([]*model.Anime{
+		{ID: 1, Title: "Naruto"},
+		{ID: 2, Title: "Boruto", AlternativeTitles: []string{"Naruto Next Generations"}},
+		{ID: 3, Title: "Hunter", Synopsis: &synopsis},
+		{ID: 4, Title: "Naruto Shippuden", Studio: &studio},
+		{ID: 5, Title: "Bleach", Studio: &studio},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		opts  Options
+		want  []int
+	}{
+		// the title outweighs the alternative titles, which outweigh the
+		// synopsis, equal scores are ordered by id
+		{"title before alternative title before synopsis", "naruto", Options{}, []int{4, 1, 2, 3}},
+		{"documents matching every term only", "naruto shippuden", Options{}, []int{4}},
+		{"any term when none matches them all", "naruto bleach", Options{}, []int{5, 4, 1, 2, 3}},
+		{"studio", "pierrot", Options{}, []int{5, 4}},
+		{"phrase in the title", "next generations", Options{}, []int{2}},
+		{"typo without fuzzy", "narto", Options{}, nil},
+		{"typo with fuzzy", "narto", Options{Fuzzy: true}, []int{4, 1, 2, 3}},
+		{"limit", "naruto", Options{Limit: 2}, []int{4, 1}},
+	}
+
+	for _, test := range tests {
+		var got []int
+		for _, r := range idx.Search(test.query, test.opts) {
+			got = append(got, r.Anime.ID)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	idx := New()
+	var anime []*model.Anime
+	for id := 1; id <= 5; id++ {
+		anime = append(anime, &model.Anime{ID: id, Title: "One Piece"})
+	}
+	idx.add(anime)
+
+	var got []int
+	for offset := 0; offset < 6; offset += 2 {
+		page := idx.Search("one piece", Options{Limit: 2, Offset: offset})
+		if len(page) > 2 {
+			t.Fatalf("offset %d: %d results, want at most 2", offset, len(page))
+		}
+		for _, r := range page {
+			got = append(got, r.Anime.ID)
+		}
+	}
+
+	// every result shows up once, in the order of a single search
+	if want := []int{5, 4, 3, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if page := idx.Search("one piece", Options{Limit: 2, Offset: 6}); len(page) != 0 {
+		t.Errorf("past the end: got %d results", len(page))
+	}
+}
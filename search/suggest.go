@@ -0,0 +1,129 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestScan caps the number of prefix entries read for one suggestion,
+// so very short prefixes stay fast.
+const maxSuggestScan = 1000
+
+// prefixEntry is a normalized title starting at one of its words, so a
+// prefix matches the beginning of any word of the title.
+type prefixEntry struct {
+	key string
+	id  int
+	// word is the position of the first word of key in the title
+	word int
+}
+
+func titleKeys(id int, titles []string) []prefixEntry {
+	var keys []prefixEntry
+	for _, title := range titles {
+		terms := Tokenize(title)
+		for i := range terms {
+			keys = append(keys, prefixEntry{
+				key:  strings.Join(terms[i:], " "),
+				id:   id,
+				word: i,
+			})
+		}
+	}
+
+	return keys
+}
+
+// addPrefixes sorts the keys once and merges them into the sorted prefixes.
+func (idx *Index) addPrefixes(keys []prefixEntry) {
+	sort.Slice(keys, func(i, j int) bool {
+		return lessPrefix(keys[i], keys[j])
+	})
+
+	merged := make([]prefixEntry, 0, len(idx.prefixes)+len(keys))
+	i, j := 0, 0
+	for i < len(idx.prefixes) && j < len(keys) {
+		if lessPrefix(keys[j], idx.prefixes[i]) {
+			merged = append(merged, keys[j])
+			j++
+		} else {
+			merged = append(merged, idx.prefixes[i])
+			i++
+		}
+	}
+	merged = append(merged, idx.prefixes[i:]...)
+	merged = append(merged, keys[j:]...)
+	idx.prefixes = merged
+}
+
+func (idx *Index) removePrefixes(keys []prefixEntry) {
+	for _, entry := range keys {
+		i := sort.Search(len(idx.prefixes), func(i int) bool {
+			return !lessPrefix(idx.prefixes[i], entry)
+		})
+		if i < len(idx.prefixes) && idx.prefixes[i] == entry {
+			idx.prefixes = append(idx.prefixes[:i], idx.prefixes[i+1:]...)
+		}
+	}
+}
+
+func lessPrefix(a, b prefixEntry) bool {
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	if a.id != b.id {
+		return a.id < b.id
+	}
+	return a.word < b.word
+}
+
+// Suggest returns up to limit documents with a title or alternative title
+// containing a word starting with the prefix. Titles starting with the prefix
+// come first, then shorter titles.
+func (idx *Index) Suggest(prefix string, limit int) []*Document {
+	prefix = strings.Join(Tokenize(prefix), " ")
+	if prefix == "" {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	start := sort.Search(len(idx.prefixes), func(i int) bool {
+		return idx.prefixes[i].key >= prefix
+	})
+
+	best := map[int]prefixEntry{}
+	for i := start; i < len(idx.prefixes) && i-start < maxSuggestScan; i++ {
+		entry := idx.prefixes[i]
+		if !strings.HasPrefix(entry.key, prefix) {
+			break
+		}
+
+		if current, ok := best[entry.id]; !ok || entry.word < current.word {
+			best[entry.id] = entry
+		}
+	}
+
+	var docs []*Document
+	for id := range best {
+		docs = append(docs, idx.docs[id])
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		a, b := best[docs[i].Anime.ID], best[docs[j].Anime.ID]
+		if (a.word == 0) != (b.word == 0) {
+			return a.word == 0
+		}
+		if len(docs[i].Anime.Title) != len(docs[j].Anime.Title) {
+			return len(docs[i].Anime.Title) < len(docs[j].Anime.Title)
+		}
+		return docs[i].Anime.ID > docs[j].Anime.ID
+	})
+
+	if limit > 0 && len(docs) > limit {
+		docs = docs[:limit]
+	}
+
+	return docs
+}
@@ -0,0 +1,57 @@
+package search
+
+import (
+	"sort"
+	"testing"
+
+	"animenya.site/model"
+)
+
+func TestSuggest(t *testing.T) {
+	idx := New()
+	idx.add([]*model.Anime{
+		{ID: 1, Title: "Shingeki no Kyojin"},
+		{ID: 2, Title: "Shingeki no Kyojin Season 2"},
+		{ID: 3, Title: "Kimetsu no Yaiba", AlternativeTitles: []string{"Demon Slayer"}},
+	})
+	idx.Add(&model.Anime{ID: 4, Title: "Kyojin no Hoshi"})
+
+	if !sort.SliceIsSorted(idx.prefixes, func(i, j int) bool {
+		return lessPrefix(idx.prefixes[i], idx.prefixes[j])
+	}) {
+		t.Fatal("prefixes are not sorted")
+	}
+
+	tests := []struct {
+		prefix string
+		want   []int
+	}{
+		{"shin", []int{1, 2}},
+		{"kyo", []int{4, 1, 2}},
+		{"slay", []int{3}},
+		{"naruto", nil},
+	}
+
+	for _, test := range tests {
+		var got []int
+		for _, doc := range idx.Suggest(test.prefix, 10) {
+			got = append(got, doc.Anime.ID)
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %v, want %v", test.prefix, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q: got %v, want %v", test.prefix, got, test.want)
+				break
+			}
+		}
+	}
+
+	idx.Add(&model.Anime{ID: 4, Title: "Hoshi no Kyojin"})
+	if got := idx.Suggest("kyojin no h", 10); len(got) != 0 {
+		t.Errorf("stale prefix still suggested: %v", got)
+	}
+}
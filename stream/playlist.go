@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IsPlaylist reports whether the response is an HLS playlist, by content type
+// or by extension since a lot of hosts serve them as text/plain.
+func IsPlaylist(contentType string, rawURL string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.Contains(contentType, "mpegurl") {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// URL returns the proxy URL of the media URL, signed until expireAt, or an
+// empty string when the proxy must not fetch it, see CheckURL.
+func URL(mediaURL string, expireAt time.Time) string {
+	u, err := url.Parse(mediaURL)
+	if err != nil || CheckURL(u) != nil {
+		return ""
+	}
+
+	name := "media"
+	if path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+
+	return fmt.Sprintf("%s/stream/%s/%s", os.Getenv("API_URL"), Sign(mediaURL, expireAt), url.PathEscape(name))
+}
+
+var uriAttrRegex = regexp.MustCompile(`URI="([^"]*)"`)
+
+// RewritePlaylist points every URI of the master or media playlist, fetched
+// from base, to the proxy. The URIs are signed with the same expiry as the
+// playlist so a stream never outlives its token. The URIs the proxy must not
+// fetch are dropped, see CheckURL.
+func RewritePlaylist(playlist string, base *url.URL, expireAt time.Time) string {
+	resolve := func(ref string) string {
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ""
+		}
+
+		return URL(u.String(), expireAt)
+	}
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(playlist))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+		case strings.HasPrefix(line, "#"):
+			// keys, maps and alternative renditions carry their URI as an attribute
+			line = uriAttrRegex.ReplaceAllStringFunc(line, func(attr string) string {
+				return `URI="` + resolve(uriAttrRegex.FindStringSubmatch(attr)[1]) + `"`
+			})
+		default:
+			if line = resolve(line); line == "" {
+				continue
+			}
+		}
+
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxied returns the media URL signed in the proxy URL.
+func proxied(t *testing.T, proxyURL string) string {
+	token, _, ok := strings.Cut(strings.TrimPrefix(proxyURL, "https://api.example.com/stream/"), "/")
+	if !ok {
+		t.Fatalf("%q is not a proxy URL", proxyURL)
+	}
+
+	mediaURL, _, err := Verify(token)
+	if err != nil {
+		t.Fatalf("%q: %v", proxyURL, err)
+	}
+	return mediaURL
+}
+
+func TestRewritePlaylist(t *testing.T) {
+	t.Setenv("API_URL", "https://api.example.com")
+
+	playlist := strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		`#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x1`,
+		`#EXT-X-MAP:URI="/init.mp4"`,
+		"#EXTINF:10.0,",
+		"seg-1.ts",
+		"#EXTINF:10.0,",
+		"../other/seg-2.ts?sig=abc",
+		"#EXTINF:10.0,",
+		"https://cdn2.example.com/seg-3.ts",
+		"#EXTINF:10.0,",
+		"http://127.0.0.1/seg-4.ts",
+		"#EXTINF:10.0,",
+		"file:///etc/passwd",
+		`#EXT-X-KEY:METHOD=AES-128,URI="http://169.254.169.254/key"`,
+		"#EXT-X-ENDLIST",
+	}, "\r\n")
+	base, _ := url.Parse("https://cdn.example.com/hls/720/index.m3u8")
+
+	lines := strings.Split(strings.TrimSuffix(RewritePlaylist(playlist, base, time.Now().Add(time.Hour)), "\n"), "\n")
+
+	attr := func(line string) string {
+		return uriAttrRegex.FindStringSubmatch(line)[1]
+	}
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"tags are kept", lines[1], "#EXT-X-VERSION:3"},
+		{"key uri", proxied(t, attr(lines[2])), "https://cdn.example.com/hls/720/key.bin"},
+		{"key attributes are kept", strings.Replace(lines[2], attr(lines[2]), "", 1), `#EXT-X-KEY:METHOD=AES-128,URI="",IV=0x1`},
+		{"map uri", proxied(t, attr(lines[3])), "https://cdn.example.com/init.mp4"},
+		{"relative segment", proxied(t, lines[5]), "https://cdn.example.com/hls/720/seg-1.ts"},
+		{"parent relative segment", proxied(t, lines[7]), "https://cdn.example.com/hls/other/seg-2.ts?sig=abc"},
+		{"absolute segment", proxied(t, lines[9]), "https://cdn2.example.com/seg-3.ts"},
+		{"private segment is dropped", lines[10] + "|" + lines[11], "#EXTINF:10.0,|#EXTINF:10.0,"},
+		{"private key uri is emptied", lines[12], `#EXT-X-KEY:METHOD=AES-128,URI=""`},
+		{"end", lines[13], "#EXT-X-ENDLIST"},
+	}
+
+	if len(lines) != 14 {
+		t.Fatalf("%d lines, want 14:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{url: "https://cdn.example.com/video.mp4"},
+		{url: "http://93.184.216.34/video.mp4"},
+		{url: "ftp://cdn.example.com/video.mp4", err: "INVALID_SCHEME"},
+		{url: "file:///etc/passwd", err: "INVALID_SCHEME"},
+		{url: "http://localhost:8080/", err: "PRIVATE_HOST"},
+		{url: "http://127.0.0.1/", err: "PRIVATE_HOST"},
+		{url: "http://10.0.0.1/", err: "PRIVATE_HOST"},
+		{url: "http://192.168.1.1/", err: "PRIVATE_HOST"},
+		{url: "http://169.254.169.254/latest/meta-data", err: "PRIVATE_HOST"},
+		{url: "http://[::1]/", err: "PRIVATE_HOST"},
+		{url: "http://[fe80::1]/", err: "PRIVATE_HOST"},
+		{url: "http://0.0.0.0/", err: "PRIVATE_HOST"},
+		{url: "http:///video.mp4", err: "INVALID_HOST"},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = CheckURL(u)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: %v", test.url, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: error %v, want %s", test.url, err, test.err)
+		}
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:443":     true,
+		"127.0.0.1:80":          false,
+		"10.1.2.3:443":          false,
+		"[::ffff:127.0.0.1]:80": false,
+		"[fd00::1]:443":         false,
+	} {
+		if err := DialControl("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("%s: error %v, allowed %v", address, err, allowed)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TokenTTL is how long a signed stream URL can be used, long enough to watch
+// a movie from its playlist.
+const TokenTTL = time.Hour * 3
+
+var (
+	secretOnce sync.Once
+	secret     []byte
+)
+
+// key returns the STREAM_SECRET env, or a random secret when it is not set,
+// which invalidates the tokens on every restart.
+func key() []byte {
+	secretOnce.Do(func() {
+		if env := os.Getenv("STREAM_SECRET"); env != "" {
+			secret = []byte(env)
+			return
+		}
+
+		log.Warn().Msg("stream.key: STREAM_SECRET is not set, using a random secret")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal().Err(err).Msg("stream.key: failed to generate secret")
+		}
+	})
+
+	return secret
+}
+
+// Sign returns a token allowing the proxy to fetch the URL until expireAt.
+func Sign(url string, expireAt time.Time) string {
+	payload := strconv.FormatInt(expireAt.Unix(), 10) + "|" + url
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + signature(payload)
+}
+
+// Verify returns the URL and expiry of a token signed by Sign.
+func Verify(token string) (string, time.Time, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("INVALID_TOKEN")
+	}
+
+	_payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("INVALID_TOKEN")
+	}
+
+	payload := string(_payload)
+	if !hmac.Equal([]byte(sig), []byte(signature(payload))) {
+		return "", time.Time{}, fmt.Errorf("INVALID_TOKEN")
+	}
+
+	_expireAt, url, ok := strings.Cut(payload, "|")
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("INVALID_TOKEN")
+	}
+
+	unix, err := strconv.ParseInt(_expireAt, 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("INVALID_TOKEN")
+	}
+
+	expireAt := time.Unix(unix, 0)
+	if time.Now().After(expireAt) {
+		return "", time.Time{}, fmt.Errorf("TOKEN_EXPIRED")
+	}
+
+	return url, expireAt, nil
+}
+
+func signature(payload string) string {
+	mac := hmac.New(sha256.New, key())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	mediaURL := "https://cdn.example.com/video/index.m3u8"
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	token := Sign(mediaURL, expireAt)
+	encoded, sig, _ := strings.Cut(token, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{name: "valid", token: token},
+		{name: "expired", token: Sign(mediaURL, time.Now().Add(-time.Minute)), err: "TOKEN_EXPIRED"},
+		{
+			name:  "tampered url",
+			token: base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(mediaURL, "cdn", "evil", 1))) + "." + sig,
+			err:   "INVALID_TOKEN",
+		},
+		{
+			name:  "tampered expiry",
+			token: base64.RawURLEncoding.EncodeToString([]byte("9999999999|"+mediaURL)) + "." + sig,
+			err:   "INVALID_TOKEN",
+		},
+		{name: "tampered signature", token: encoded + "." + strings.Repeat("A", len(sig)), err: "INVALID_TOKEN"},
+		{name: "no signature", token: encoded, err: "INVALID_TOKEN"},
+		{name: "not base64", token: "!!!." + sig, err: "INVALID_TOKEN"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url, gotExpireAt, err := Verify(test.token)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url != mediaURL {
+				t.Errorf("url %q, want %q", url, mediaURL)
+			}
+			if !gotExpireAt.Equal(expireAt) {
+				t.Errorf("expire at %s, want %s", gotExpireAt, expireAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package subtitle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"animenya.site/model"
+)
+
+const (
+	downloadTimeout = time.Second * 15
+	// maxSubtitleSize is the maximum size of a downloaded subtitle
+	maxSubtitleSize = 4 << 20
+)
+
+var client = &http.Client{Timeout: downloadTimeout}
+
+// Download returns the subtitle file, requested as if embedded by the source
+// site.
+func Download(ctx context.Context, subtitleURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, subtitleURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("referer", os.Getenv("SOURCE_URL"))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("NOT_FOUND")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("STATUS_CODE_NOT_OK")
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxSubtitleSize))
+}
+
+// ToVTT converts the subtitle to WebVTT. The content is sniffed first since
+// a lot of hosts serve subtitles without a meaningful extension.
+func ToVTT(content []byte, format model.SubtitleFormat) ([]byte, error) {
+	text := strings.TrimPrefix(string(content), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(text), "WEBVTT"):
+		return []byte(text), nil
+	case strings.Contains(text, "[Events]"):
+		return assToVTT(text)
+	case format == model.SubtitleFormatSRT || srtTimeRegex.MatchString(text):
+		return srtToVTT(text), nil
+	}
+
+	return nil, fmt.Errorf("UNKNOWN_SUBTITLE_FORMAT")
+}
+
+var srtTimeRegex = regexp.MustCompile(`(\d{1,2}:\d{2}:\d{2}),(\d{3})`)
+
+// srtToVTT only needs the header and dots as millisecond separators, the cue
+// numbers are valid WebVTT cue identifiers.
+func srtToVTT(text string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n\n")
+	buf.WriteString(srtTimeRegex.ReplaceAllString(strings.TrimSpace(text), "$1.$2"))
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+var (
+	assOverrideRegex = regexp.MustCompile(`\{[^}]*\}`)
+	assTimeRegex     = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})[.:](\d{2})$`)
+)
+
+// assToVTT keeps the dialogue text of the ASS/SSA events, the styles and
+// positioning overrides have no WebVTT equivalent.
+func assToVTT(text string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n\n")
+
+	var inEvents bool
+	fields := map[string]int{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "Format":
+			for i, field := range strings.Split(value, ",") {
+				fields[strings.TrimSpace(field)] = i
+			}
+		case "Dialogue":
+			start, okStart := fields["Start"]
+			end, okEnd := fields["End"]
+			textField, okText := fields["Text"]
+			if !okStart || !okEnd || !okText {
+				return nil, fmt.Errorf("INVALID_ASS_FORMAT")
+			}
+
+			// the text is the last field and may contain commas
+			values := strings.SplitN(value, ",", len(fields))
+			if len(values) != len(fields) {
+				continue
+			}
+
+			startTime, err := assTime(values[start])
+			if err != nil {
+				continue
+			}
+			endTime, err := assTime(values[end])
+			if err != nil {
+				continue
+			}
+
+			cue := assOverrideRegex.ReplaceAllString(values[textField], "")
+			cue = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(cue)
+			cue = strings.TrimSpace(cue)
+			if cue == "" {
+				continue
+			}
+
+			fmt.Fprintf(&buf, "%s --> %s\n%s\n\n", startTime, endTime, cue)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// assTime converts an ASS time, h:mm:ss.cc, to a WebVTT time.
+func assTime(str string) (string, error) {
+	match := assTimeRegex.FindStringSubmatch(strings.TrimSpace(str))
+	if match == nil {
+		return "", fmt.Errorf("INVALID_TIME")
+	}
+
+	return fmt.Sprintf("%02s:%s:%s.%s0", match[1], match[2], match[3], match[4]), nil
+}
@@ -0,0 +1,77 @@
+package subtitle
+
+import (
+	"testing"
+
+	"animenya.site/model"
+)
+
+func TestToVTT(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  model.SubtitleFormat
+		want    string
+		err     string
+	}{
+		{
+			name:    "srt with a byte order mark and windows line endings",
+			format:  model.SubtitleFormatSRT,
+			content: "\ufeff1\r\n00:00:01,500 --> 00:00:03,250\r\nHalo\r\n\r\n2\r\n00:01:02,000 --> 01:00:04,005\r\nDua baris\r\nteks\r\n",
+			want:    "WEBVTT\n\n1\n00:00:01.500 --> 00:00:03.250\nHalo\n\n2\n00:01:02.000 --> 01:00:04.005\nDua baris\nteks\n",
+		},
+		{
+			name:    "srt sniffed behind a wrong format",
+			content: "1\n0:00:01,000 --> 0:00:02,000\nHalo\n",
+			format:  model.SubtitleFormatVTT,
+			want:    "WEBVTT\n\n1\n0:00:01.000 --> 0:00:02.000\nHalo\n",
+		},
+		{
+			name:    "vtt is kept",
+			format:  model.SubtitleFormatVTT,
+			content: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHalo\n",
+			want:    "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHalo\n",
+		},
+		{
+			name:   "ass dialogue without styles",
+			format: model.SubtitleFormatASS,
+			content: "[Script Info]\nTitle: Test\n\n[V4+ Styles]\nFormat: Name, Fontname\nStyle: Default,Arial\n\n" +
+				"[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Comment: 0,0:00:00.00,0:00:01.00,Default,,0,0,0,,not shown\n" +
+				"Dialogue: 0,0:00:01.50,0:00:03.25,Default,,0,0,0,,{\\an8}Halo, dunia\\Nbaris dua\n" +
+				"Dialogue: 0,1:02:03.04,1:02:05.00,Default,,0,0,0,,{\\pos(10,10)}\n" +
+				"Dialogue: 0,10:00:00.00,10:00:01.00,Default,,0,0,0,,Akhir\\hcerita\n",
+			want: "WEBVTT\n\n00:00:01.500 --> 00:00:03.250\nHalo, dunia\nbaris dua\n\n10:00:00.000 --> 10:00:01.000\nAkhir cerita\n\n",
+		},
+		{
+			name:    "ass dialogue before its format",
+			format:  model.SubtitleFormatASS,
+			content: "[Events]\nDialogue: 0,0:00:01.50,0:00:03.25,Default,,0,0,0,,Halo\n",
+			err:     "INVALID_ASS_FORMAT",
+		},
+		{
+			name:    "unknown format",
+			format:  model.SubtitleFormatVTT,
+			content: "<tt><body>Halo</body></tt>",
+			err:     "UNKNOWN_SUBTITLE_FORMAT",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ToVTT([]byte(test.content), test.format)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}